@@ -0,0 +1,111 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchivedTask contains information about a completed task that was moved
+// into the archive (see WithArchive).
+type ArchivedTask struct {
+	TaskDetails
+	WorkerID    string
+	CompletedAt time.Time
+}
+
+func (at *ArchivedTask) scan(rows rowScanner) error {
+	var uniqueKey sql.NullString
+	var uniqueFor int64
+	var result []byte
+	if err := rows.Scan(
+		&at.ID,
+		&at.Namespace,
+		&at.Priority,
+		&at.Payload,
+		&at.NotBefore,
+		&at.MaxAttempts,
+		&uniqueKey,
+		&uniqueFor,
+		&at.Attempts,
+		&result,
+		&at.WorkerID,
+		&at.CreatedAt,
+		&at.UpdatedAt,
+		&at.CompletedAt,
+	); err != nil {
+		return err
+	}
+	at.UniqueKey = uniqueKey.String
+	at.UniqueFor = time.Duration(uniqueFor) * time.Microsecond
+	at.Status = StatusCompleted
+	at.Result = result
+	at.FinishedAt = at.CompletedAt
+	return nil
+}
+
+// GetArchived returns an archived task by ID. It may return ErrNoTask.
+func (c *Client) GetArchived(ctx context.Context, id uuid.UUID) (*ArchivedTask, error) {
+	at := new(ArchivedTask)
+	row := c.db.QueryRowContext(ctx, stmtGetArchived, id)
+	if err := at.scan(row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTask
+		}
+		return nil, err
+	}
+	return at, nil
+}
+
+// ListArchive lists archived tasks, most recently completed first.
+func (c *Client) ListArchive(ctx context.Context, opts ...ListOption) ([]*ArchivedTask, error) {
+	opt := &listOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return nil, err
+	} else if opt.Cursor != nil {
+		return nil, fmt.Errorf("cursors are not supported by the archive")
+	}
+	limit := opt.getLimit()
+
+	query, args := opt.build(stmtListArchive, limit, c.clock.Now())
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*ArchivedTask, 0, limit)
+	for rows.Next() {
+		task := new(ArchivedTask)
+		if err := task.scan(rows); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// PurgeArchive permanently deletes archived tasks which completed more than
+// olderThan ago. It returns the number of deleted tasks.
+func (c *Client) PurgeArchive(ctx context.Context, olderThan time.Duration, opts ...ScopeOption) (int64, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	res, err := c.db.ExecContext(ctx, `DELETE FROM pgpq_tasks_archive WHERE namespace = $1 AND completed_at < $2`, opt.Namespace, c.clock.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,102 @@
+package pgpq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+)
+
+func TestClaim_Done_archive(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	claim, err := client.Claim(ctx, task1.ID, WithArchive(), WithWorkerID("w1"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claim, err = client.Claim(ctx, task2.ID, WithArchive(), WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.DoneWithResult(ctx, json.RawMessage(`"ok"`)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	at, err := client.GetArchived(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := "w1", at.WorkerID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := int32(1), at.Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := mockNow, at.CompletedAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := `{"foo": 1}`, string(at.Payload); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if at.Result != nil {
+		t.Errorf("expected no result, got %s", at.Result)
+	}
+
+	tasks, err := client.ListArchive(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 2, len(tasks); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for _, at := range tasks {
+		if at.ID == task2.ID {
+			if exp, got := `"ok"`, string(at.Result); exp != got {
+				t.Errorf("expected %v, got %v", exp, got)
+			}
+		}
+	}
+
+	if tasks, err := client.ListArchive(ctx, WithNamespace("baz")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 0, len(tasks); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_PurgeArchive(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	claim, err := client.Claim(ctx, task1.ID, WithArchive())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n, err := client.PurgeArchive(ctx, time.Hour); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		if n, err := client.PurgeArchive(ctx, time.Hour); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := int64(1), n; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+
+	if _, err := client.GetArchived(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
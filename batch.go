@@ -0,0 +1,362 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// pushBatchSize is the maximum number of tasks inserted per statement.
+const pushBatchSize = 1000
+
+// BatchError is returned when individual items of a batch failed.
+type BatchError struct {
+	// Errors contains an entry for each item of the batch, nil on success.
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	var failed int
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d batch items failed", failed, len(e.Errors))
+}
+
+// Unwrap returns the errors of the failed items.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// BatchClaim contains claims on multiple tasks which share a single
+// transaction. Outcomes of individual claims (Done, Update, Bury, etc.) are
+// only applied once the batch is committed, a failed outcome does not affect
+// the other claims of the batch. Tasks without an outcome are returned back to
+// the queue. You must call either Commit or Release to release the batch.
+type BatchClaim struct {
+	Claims []*Claim
+	tx     *sql.Tx
+}
+
+// Commit applies the outcomes of all claims and releases the batch.
+func (b *BatchClaim) Commit(_ context.Context) error {
+	b.finish()
+	return b.tx.Commit()
+}
+
+// Release discards the outcomes of all claims and returns all tasks back to
+// the queue. The attempts are still counted towards the tasks' MaxAttempts.
+func (b *BatchClaim) Release(ctx context.Context) error {
+	b.finish()
+	if _, err := b.tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT pgpq_batch`); err != nil {
+		_ = b.tx.Rollback()
+		return err
+	}
+	return b.tx.Commit()
+}
+
+func (b *BatchClaim) finish() {
+	for _, claim := range b.Claims {
+		claim.finish()
+	}
+}
+
+// ShiftN locks and returns up to n non-delayed tasks with the highest
+// priority in a single transaction, see Shift. Batches always use
+// transaction-based claims, lease options are ignored. Batches are shifted from
+// a single namespace, WithNamespaces and its variants are not supported. It
+// may return ErrNoTask.
+func (c *Client) ShiftN(ctx context.Context, n int, opts ...ScopeOption) (*BatchClaim, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace, Archive: c.opt.Archive, WorkerID: c.opt.WorkerID}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("batch size %d must be positive", n)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := c.shiftN(ctx, tx, opt, n)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return batch, nil
+}
+
+func (c *Client) shiftN(ctx context.Context, tx *sql.Tx, opt *scopeOptions, n int) (*BatchClaim, error) {
+	rows, err := tx.QueryContext(ctx, stmtShiftN, opt.Namespace, c.clock.Now(), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batch := &BatchClaim{Claims: make([]*Claim, 0, n), tx: tx}
+	for rows.Next() {
+		claim := &Claim{db: c.db, tx: tx, clock: c.clock, batch: true, index: len(batch.Claims), archive: opt.Archive, workerID: opt.WorkerID, done: make(chan struct{})}
+		if err := claim.TaskDetails.scan(rows); err != nil {
+			return nil, err
+		}
+		batch.Claims = append(batch.Claims, claim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	} else if len(batch.Claims) == 0 {
+		return nil, ErrNoTask
+	}
+
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT pgpq_batch`); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// PushBatch pushes multiple tasks into the queue using multi-row inserts. IDs
+// are generated for tasks without one. Tasks that collide with existing IDs or
+// unique keys are skipped and reported as ErrDuplicateID or ErrDuplicateKey
+// via a *BatchError, all other tasks are pushed.
+func (c *Client) PushBatch(ctx context.Context, tasks []*Task) error {
+	batchErr := &BatchError{Errors: make([]error, len(tasks))}
+	pending := make([]*Task, 0, len(tasks))
+	explicit := make(map[uuid.UUID]struct{}, len(tasks))
+	seen := make(map[uuid.UUID]struct{}, len(tasks))
+	seenKeys := make(map[namespacedKey]struct{})
+
+	for i, task := range tasks {
+		if err := c.normTask(task); err != nil {
+			return err
+		}
+		if task.ID == uuid.Nil {
+			task.ID = uuid.New()
+		} else {
+			explicit[task.ID] = struct{}{}
+		}
+
+		if _, ok := seen[task.ID]; ok {
+			batchErr.Errors[i] = ErrDuplicateID
+			continue
+		}
+		if task.UniqueKey != "" {
+			key := namespacedKey{Namespace: task.Namespace, Key: task.UniqueKey}
+			if _, ok := seenKeys[key]; ok {
+				batchErr.Errors[i] = ErrDuplicateKey
+				continue
+			}
+			seenKeys[key] = struct{}{}
+		}
+		seen[task.ID] = struct{}{}
+		pending = append(pending, task)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if len(seenKeys) != 0 {
+		reserved, err := c.reservedKeys(ctx, tx, seenKeys)
+		if err != nil {
+			return err
+		}
+
+		pending = pending[:0]
+		for i, task := range tasks {
+			if batchErr.Errors[i] != nil {
+				continue
+			} else if _, ok := reserved[namespacedKey{Namespace: task.Namespace, Key: task.UniqueKey}]; ok {
+				batchErr.Errors[i] = ErrDuplicateKey
+				continue
+			}
+			pending = append(pending, task)
+		}
+	}
+
+	inserted := make(map[uuid.UUID]struct{}, len(pending))
+	for offset := 0; offset < len(pending); offset += pushBatchSize {
+		chunk := pending[offset:]
+		if len(chunk) > pushBatchSize {
+			chunk = chunk[:pushBatchSize]
+		}
+
+		if err := c.pushChunk(ctx, tx, chunk, inserted); err != nil {
+			return err
+		}
+	}
+
+	if err := c.pushBatchDeps(ctx, tx, pending, inserted); err != nil {
+		return err
+	}
+
+	// tasks with an explicit ID and a unique key may collide on either
+	var ambiguous []string
+	for _, task := range pending {
+		if _, ok := inserted[task.ID]; ok || task.UniqueKey == "" {
+			continue
+		} else if _, ok := explicit[task.ID]; ok {
+			ambiguous = append(ambiguous, task.ID.String())
+		}
+	}
+
+	existing := make(map[uuid.UUID]struct{}, len(ambiguous))
+	if len(ambiguous) != 0 {
+		if err := c.existingIDs(ctx, tx, ambiguous, existing); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	var failed bool
+	for i, task := range tasks {
+		if batchErr.Errors[i] != nil {
+			failed = true
+		} else if _, ok := inserted[task.ID]; !ok {
+			batchErr.Errors[i] = ErrDuplicateID
+			if _, ok := existing[task.ID]; !ok && task.UniqueKey != "" {
+				batchErr.Errors[i] = ErrDuplicateKey
+			}
+			failed = true
+		}
+	}
+	if failed {
+		return batchErr
+	}
+	return nil
+}
+
+type namespacedKey struct {
+	Namespace, Key string
+}
+
+func (c *Client) reservedKeys(ctx context.Context, tx *sql.Tx, keys map[namespacedKey]struct{}) (map[namespacedKey]struct{}, error) {
+	values := make([]string, 0, len(keys))
+	for key := range keys {
+		values = append(values, key.Key)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT namespace, unique_key
+		FROM pgpq_unique_keys
+		WHERE unique_key = ANY($1)
+			AND reserved_until > $2
+	`, values, c.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reserved := make(map[namespacedKey]struct{})
+	for rows.Next() {
+		var key namespacedKey
+		if err := rows.Scan(&key.Namespace, &key.Key); err != nil {
+			return nil, err
+		}
+		if _, ok := keys[key]; ok {
+			reserved[key] = struct{}{}
+		}
+	}
+	return reserved, rows.Err()
+}
+
+func (c *Client) pushBatchDeps(ctx context.Context, tx *sql.Tx, tasks []*Task, inserted map[uuid.UUID]struct{}) error {
+	var taskIDs, parentIDs []string
+	var cancel []bool
+	for _, task := range tasks {
+		if _, ok := inserted[task.ID]; !ok {
+			continue
+		}
+		for _, parentID := range task.DependsOn {
+			taskIDs = append(taskIDs, task.ID.String())
+			parentIDs = append(parentIDs, parentID.String())
+			cancel = append(cancel, task.CancelOnParentFailure)
+		}
+	}
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO pgpq_task_deps (task_id, parent_id, cancel_on_failure)
+		SELECT * FROM UNNEST($1::UUID[], $2::UUID[], $3::BOOLEAN[])
+		ON CONFLICT DO NOTHING
+	`, taskIDs, parentIDs, cancel)
+	return err
+}
+
+func (c *Client) existingIDs(ctx context.Context, tx *sql.Tx, ids []string, existing map[uuid.UUID]struct{}) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM pgpq_tasks WHERE id = ANY($1::UUID[])`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		existing[id] = struct{}{}
+	}
+	return rows.Err()
+}
+
+func (c *Client) pushChunk(ctx context.Context, tx *sql.Tx, tasks []*Task, inserted map[uuid.UUID]struct{}) error {
+	const numCols = 8
+
+	args := make([]interface{}, 0, 1+len(tasks)*numCols)
+	args = append(args, c.clock.Now())
+
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, updated_at) VALUES `)
+	for i, task := range tasks {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for j := 0; j < numCols; j++ {
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(len(args) + j + 1))
+			sb.WriteString(", ")
+		}
+		sb.WriteString("$1, $1)")
+
+		args = append(args, task.ID, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), task.MaxAttempts, task.uniqueKey(), task.uniqueFor())
+	}
+	sb.WriteString(` ON CONFLICT DO NOTHING RETURNING id`)
+
+	rows, err := tx.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		inserted[id] = struct{}{}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,174 @@
+package pgpq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/bsm/pgpq"
+	"github.com/google/uuid"
+)
+
+func TestClient_PushBatch(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	if err := client.Push(ctx, &Task{ID: mockUUID}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	custom := uuid.New()
+	tasks := []*Task{
+		{Priority: 1},
+		{ID: mockUUID},
+		{ID: custom, Namespace: "baz"},
+		{ID: custom},
+		{Payload: []byte(`{"foo":1}`)},
+	}
+
+	err := client.PushBatch(ctx, tasks)
+	if !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("expected %v, got %v", ErrDuplicateID, err)
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected batch error, got %v", err)
+	}
+	assertEqual(t, batchErr.Errors, []error{nil, ErrDuplicateID, nil, ErrDuplicateID, nil})
+
+	for _, task := range tasks {
+		if task.ID == uuid.Nil {
+			t.Errorf("expected ID to be set")
+		}
+	}
+
+	if got, err := client.Len(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp := int64(3); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if got, err := client.Len(ctx, WithNamespace("baz")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp := int64(1); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// no collisions
+	if err := client.PushBatch(ctx, []*Task{{}, {}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestClient_PushBatch_uniqueKey(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	if err := client.Push(ctx, &Task{ID: mockUUID, UniqueKey: "a"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tasks := []*Task{
+		{UniqueKey: "a"},
+		{UniqueKey: "b"},
+		{UniqueKey: "b"},
+		{ID: mockUUID, UniqueKey: "c"},
+		{UniqueKey: "a", Namespace: "baz"},
+	}
+
+	err := client.PushBatch(ctx, tasks)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected batch error, got %v", err)
+	}
+	for i, exp := range []error{ErrDuplicateKey, nil, ErrDuplicateKey, ErrDuplicateID, nil} {
+		if got := batchErr.Errors[i]; !errors.Is(got, exp) {
+			t.Errorf("[%d] expected %v, got %v", i, exp, got)
+		}
+	}
+}
+
+func TestClient_ShiftN(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	batch, err := client.ShiftN(ctx, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer batch.Release(ctx)
+
+	if exp, got := 2, len(batch.Claims); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	} else if exp, got := task1.ID, batch.Claims[0].ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := task2.ID, batch.Claims[1].ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// all tasks are locked
+	if _, err := client.Shift(ctx); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.ShiftN(ctx, 5); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	// complete task #1, release task #2
+	if err := batch.Claims[0].Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := batch.Claims[1].Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// nothing applied yet
+	if got, err := client.Len(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp := int64(2); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if tasks, err := client.List(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(tasks); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	} else if exp, got := task2.ID, tasks[0].ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := int32(1), tasks[0].Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestBatchClaim_Release(t *testing.T) {
+	ctx := context.Background()
+	seedTriple(ctx, t)
+
+	batch, err := client.ShiftN(ctx, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := batch.Claims[0].Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := batch.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tasks, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 2, len(tasks); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for _, td := range tasks {
+		if exp, got := int32(1), td.Attempts; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	}
+}
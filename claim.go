@@ -3,45 +3,316 @@ package pgpq
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/google/uuid"
 )
 
 // Claim contains a claim on a task. The owner of the claim has an exclusive
-// lock on the task. You must call either Release, Update or Done to release the
-// claim.
+// lock on the task. You must call either Release, Update, Done, Fail or Bury to
+// release the claim.
+//
+// By default, claims hold an open transaction until they are released.
+// Lease-based claims (see WithLease) lock the task until LockedUntil instead
+// and may return ErrLeaseLost if the lease has expired and the task was
+// claimed by someone else in the meantime.
 type Claim struct {
 	TaskDetails
-	tx    *sql.Tx
-	clock clock.Clock
+	db        *sql.DB
+	tx        *sql.Tx
+	lease     uuid.NullUUID
+	ttl       time.Duration
+	clock     clock.Clock
+	batch     bool
+	index     int
+	savepoint bool
+	archive   bool
+	workerID  string
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Extend extends a lease-based claim until d from now. It returns
+// ErrLeaseLost if the lease has expired and the task was claimed by someone
+// else or removed from the queue in the meantime. Transaction-based claims do
+// not expire and Extend is a no-op for these.
+func (tc *Claim) Extend(ctx context.Context, d time.Duration) error {
+	lockedUntil, err := tc.extend(ctx, d)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		tc.LockedUntil = lockedUntil
+	}
+	return nil
+}
+
+// KeepAlive starts a background heartbeat which extends a lease-based claim by
+// its original lease duration every interval. The heartbeat stops once the
+// claim is released or ctx is cancelled. The returned context is cancelled
+// when the heartbeat stops. If the lease was lost, context.Cause will return
+// ErrLeaseLost and the work should be aborted.
+func (tc *Claim) KeepAlive(ctx context.Context, interval time.Duration) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+	ticker := tc.clock.Ticker(interval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tc.done:
+				cancel(nil)
+				return
+			case <-ticker.C:
+				if _, err := tc.extend(ctx, tc.ttl); errors.Is(err, ErrLeaseLost) {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+	return ctx
+}
+
+// Tx returns a transaction for database work which should be applied
+// atomically with the outcome of the claim. Changes made within the
+// transaction are committed by Done and Update and discarded by Release, Fail
+// and Bury. Lease-based claims begin a new transaction on the first call,
+// claims that are part of a batch share the transaction of the batch. Within a
+// batch, release a claim before calling Tx on the next one.
+func (tc *Claim) Tx(ctx context.Context) (*sql.Tx, error) {
+	if tc.lease.Valid {
+		if tc.tx == nil {
+			tx, err := tc.db.BeginTx(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			tc.tx = tx
+		}
+	} else if !tc.savepoint {
+		if _, err := tc.tx.ExecContext(ctx, `SAVEPOINT `+tc.savepointName()); err != nil {
+			return nil, err
+		}
+		tc.savepoint = true
+	}
+	return tc.tx, nil
+}
+
+// Release releases the claim and returns the task back to the queue. The
+// attempt is still counted towards the task's MaxAttempts.
+func (tc *Claim) Release(ctx context.Context) error {
+	if err := tc.discard(ctx); err != nil {
+		tc.finish()
+		return err
+	}
+
+	if tc.batch {
+		cancelled, err := tc.Cancelled(ctx)
+		if err != nil || !cancelled {
+			tc.finish()
+			return err
+		}
+		return tc.exec(ctx, stmtDropCancelled, tc.ID, tc.lease)
+	}
+	return tc.requeue(ctx, stmtRelease, tc.ID, tc.lease)
 }
 
-// Release releases the claim and returns the task back to the queue.
-func (tc *Claim) Release(_ context.Context) error {
-	return tc.tx.Rollback()
+// Cancelled returns true if the task was cancelled while being claimed (see
+// Client.Cancel). Cancelled tasks are removed from the queue instead of being
+// returned on Release, Update or Fail.
+func (tc *Claim) Cancelled(ctx context.Context) (bool, error) {
+	var cancelled bool
+	if err := tc.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pgpq_cancellations WHERE task_id = $1)`, tc.ID).Scan(&cancelled); err != nil {
+		return false, err
+	}
+	return cancelled, nil
 }
 
-// Update updates Namespace, Payload, Priority, UpdatedAt and returns the task
-// back to the queue.
+// Update updates Namespace, Payload, Priority, NotBefore, MaxAttempts,
+// UpdatedAt and returns the task back to the queue.
 func (tc *Claim) Update(ctx context.Context) error {
 	if err := tc.validate(); err != nil {
 		return err
 	}
 
-	_, err := tc.tx.ExecContext(ctx, stmtUpdate, tc.Namespace, tc.Priority, unsafeString(tc.Payload), coalesceTime(tc.NotBefore, unixZero), tc.clock.Now(), tc.ID)
-	if err != nil {
+	return tc.requeue(ctx, stmtUpdate, tc.Namespace, tc.Priority, unsafeString(tc.Payload), coalesceTime(tc.NotBefore, unixZero), tc.MaxAttempts, tc.clock.Now(), tc.ID, tc.lease)
+}
+
+// Done marks the task as done and removes it from the queue. If archiving is
+// enabled (see WithArchive), the task is moved into the archive.
+func (tc *Claim) Done(ctx context.Context) error {
+	return tc.exec(ctx, stmtDone, tc.ID, tc.lease, tc.clock.Now(), nil, tc.archive, tc.workerID)
+}
+
+// DoneWithResult marks the task as done, removes it from the queue and
+// retains the result. Completed tasks can be retrieved via Client.Get and
+// Client.Await until they are purged (see Client.PurgeResults).
+func (tc *Claim) DoneWithResult(ctx context.Context, result json.RawMessage) error {
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+	return tc.exec(ctx, stmtDone, tc.ID, tc.lease, tc.clock.Now(), unsafeString(result), tc.archive, tc.workerID)
+}
+
+// Fail records a failed attempt. If the task has exhausted its MaxAttempts, it
+// is buried with the given reason, otherwise it is returned back to the queue.
+func (tc *Claim) Fail(ctx context.Context, reason string) error {
+	if tc.MaxAttempts > 0 && tc.Attempts >= tc.MaxAttempts {
+		return tc.Bury(ctx, reason)
+	}
+	return tc.Release(ctx)
+}
+
+// Retry is like Fail, but delays the next attempt by d.
+func (tc *Claim) Retry(ctx context.Context, reason string, d time.Duration) error {
+	if tc.MaxAttempts > 0 && tc.Attempts >= tc.MaxAttempts {
+		return tc.Bury(ctx, reason)
+	}
+
+	if err := tc.discard(ctx); err != nil {
+		tc.finish()
 		return err
 	}
+	return tc.requeue(ctx, stmtRetry, tc.ID, tc.lease, tc.clock.Now().Add(d))
+}
 
+// Bury removes the task from the queue and moves it to the dead tasks, along
+// with the given reason.
+func (tc *Claim) Bury(ctx context.Context, reason string) error {
+	if err := tc.discard(ctx); err != nil {
+		tc.finish()
+		return err
+	}
+	return tc.exec(ctx, stmtBury, tc.ID, reason, tc.clock.Now(), tc.lease)
+}
+
+// exec executes a statement which releases the claim. Transactions are
+// committed (unless they are part of a batch), lease-based claims validate
+// that the statement affected the task.
+func (tc *Claim) exec(ctx context.Context, query string, args ...interface{}) error {
+	defer tc.finish()
+
+	if tc.tx == nil {
+		return tc.execLease(ctx, tc.db, query, args...)
+	} else if tc.batch {
+		return tc.execBatch(ctx, query, args...)
+	}
+
+	if err := tc.execLease(ctx, tc.tx, query, args...); err != nil {
+		_ = tc.tx.Rollback()
+		return err
+	}
 	return tc.tx.Commit()
 }
 
-// Done marks the task as done and removes it from the queue.
-func (tc *Claim) Done(ctx context.Context) error {
-	_, err := tc.tx.ExecContext(ctx, stmtDone, tc.ID)
+// execBatch executes a statement within the savepoint of a claim that is part
+// of a batch, so that a failure only discards the outcome of this claim.
+func (tc *Claim) execBatch(ctx context.Context, query string, args ...interface{}) error {
+	name := tc.savepointName()
+	if !tc.savepoint {
+		if _, err := tc.tx.ExecContext(ctx, `SAVEPOINT `+name); err != nil {
+			return err
+		}
+		tc.savepoint = true
+	}
+
+	if err := tc.execLease(ctx, tc.tx, query, args...); err != nil {
+		_, _ = tc.tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT `+name)
+		return err
+	}
+	_, err := tc.tx.ExecContext(ctx, `RELEASE SAVEPOINT `+name)
+	return err
+}
+
+// requeue executes a statement which returns the task back to the queue,
+// unless the task was cancelled in which case it is removed.
+func (tc *Claim) requeue(ctx context.Context, query string, args ...interface{}) error {
+	cancelled, err := tc.Cancelled(ctx)
 	if err != nil {
+		tc.abort()
 		return err
+	} else if cancelled {
+		return tc.exec(ctx, stmtDropCancelled, tc.ID, tc.lease)
 	}
+	return tc.exec(ctx, query, args...)
+}
 
-	return tc.tx.Commit()
+// abort releases the claim after a failure.
+func (tc *Claim) abort() {
+	defer tc.finish()
+
+	if tc.tx != nil && !tc.batch {
+		_ = tc.tx.Rollback()
+	}
+}
+
+// discard discards changes made within the transaction returned by Tx.
+func (tc *Claim) discard(ctx context.Context) error {
+	if tc.lease.Valid {
+		if tc.tx != nil {
+			err := tc.tx.Rollback()
+			tc.tx = nil
+			return err
+		}
+	} else if tc.savepoint {
+		if _, err := tc.tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT `+tc.savepointName()); err != nil {
+			if !tc.batch {
+				_ = tc.tx.Rollback()
+			}
+			return err
+		}
+		// the savepoint is retained and reused by execBatch
+		tc.savepoint = tc.batch
+	}
+	return nil
+}
+
+// savepointName returns the name of the savepoint used by Tx, which is unique
+// within a batch.
+func (tc *Claim) savepointName() string {
+	if tc.batch {
+		return "pgpq_claim_" + strconv.Itoa(tc.index)
+	}
+	return "pgpq_claim"
+}
+
+// execLease executes a statement on a claim and returns ErrLeaseLost if the
+// task was not affected.
+func (tc *Claim) execLease(ctx context.Context, conn interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, query string, args ...interface{}) error {
+	res, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (tc *Claim) extend(ctx context.Context, d time.Duration) (time.Time, error) {
+	if !tc.lease.Valid {
+		return time.Time{}, nil
+	}
+
+	lockedUntil := tc.clock.Now().Add(d)
+	if err := tc.execLease(ctx, tc.db, stmtExtend, lockedUntil, tc.ID, tc.lease); err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil, nil
+}
+
+func (tc *Claim) finish() {
+	tc.doneOnce.Do(func() { close(tc.done) })
 }
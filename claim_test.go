@@ -0,0 +1,299 @@
+package pgpq_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+)
+
+func TestClaim_Extend(t *testing.T) {
+	ctx := context.Background()
+	seedTriple(ctx, t)
+
+	claim1, err := client.Shift(ctx, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim1.Release(ctx)
+
+	if err := claim1.Extend(ctx, 5*time.Minute); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := mockNow.Add(5*time.Minute), claim1.LockedUntil; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// extended lease is still valid
+	timeTravel(mockNow.Add(2*time.Minute), func() {
+		claim2, err := client.Shift(ctx, WithLease(time.Minute))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer claim2.Release(ctx)
+
+		if claim1.ID == claim2.ID {
+			t.Errorf("expected different tasks, got %v", claim2.ID)
+		}
+	})
+
+	// lease expires and is taken over
+	timeTravel(mockNow.Add(10*time.Minute), func() {
+		claim3, err := client.Claim(ctx, claim1.ID, WithLease(time.Minute))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer claim3.Release(ctx)
+	})
+
+	if err := claim1.Extend(ctx, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected %v, got %v", ErrLeaseLost, err)
+	}
+}
+
+func TestClaim_KeepAlive(t *testing.T) {
+	ctx := context.Background()
+	seedTriple(ctx, t)
+
+	// stops on release
+	claim1, err := client.Shift(ctx, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	kctx := claim1.KeepAlive(ctx, 10*time.Millisecond)
+	if err := claim1.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	select {
+	case <-kctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected heartbeat to stop")
+	}
+	if err := context.Cause(kctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	// stops when lease is lost
+	claim2, err := client.Shift(ctx, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim2.Release(ctx)
+
+	kctx = claim2.KeepAlive(ctx, 10*time.Millisecond)
+	timeTravel(mockNow.Add(2*time.Minute), func() {
+		claim3, err := client.Claim(ctx, claim2.ID, WithLease(time.Minute))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer claim3.Release(ctx)
+
+		claim2.AddTime(10 * time.Millisecond)
+		select {
+		case <-kctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected heartbeat to stop")
+		}
+		if err := context.Cause(kctx); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("expected %v, got %v", ErrLeaseLost, err)
+		}
+	})
+}
+
+func TestClaim_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	for _, opts := range [][]ScopeOption{nil, {WithLease(time.Minute)}} {
+		task1, task2, _ := seedTriple(ctx, t)
+
+		claim, err := client.Shift(ctx, opts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := task1.ID, claim.ID; exp != got {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+		if err := claim.Retry(ctx, "boom", time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// task is delayed, attempt is counted
+		task, err := client.Get(ctx, task1.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := mockNow.Add(time.Minute), task.NotBefore; !exp.Equal(got) {
+			t.Errorf("expected %v, got %v", exp, got)
+		} else if exp, got := int32(1), task.Attempts; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+
+		if err := doTaskWith(ctx, func(claim *Claim) error {
+			if exp, got := task2.ID, claim.ID; exp != got {
+				t.Errorf("expected %v, got %v", exp, got)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// exhausted tasks are buried
+	truncate(ctx, t)
+	if err := client.Push(ctx, &Task{MaxAttempts: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claim, err := client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Retry(ctx, "boom", time.Minute); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dead, err := client.GetDead(ctx, claim.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := "boom", dead.Reason; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClaim_Tx(t *testing.T) {
+	ctx := context.Background()
+	seedTriple(ctx, t)
+
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS pgpq_test_effects (task_id UUID NOT NULL)`); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `TRUNCATE pgpq_test_effects`); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	countEffects := func() (cnt int) {
+		t.Helper()
+
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pgpq_test_effects`).Scan(&cnt); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return
+	}
+
+	for _, opts := range [][]ScopeOption{nil, {WithLease(time.Minute)}} {
+		if _, err := db.ExecContext(ctx, `TRUNCATE pgpq_test_effects`); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// effects are discarded on release
+		claim, err := client.Shift(ctx, opts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		tx, err := claim.Tx(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pgpq_test_effects (task_id) VALUES ($1)`, claim.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := claim.Release(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exp, got := 0, countEffects(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+
+		// attempt is still counted
+		task, err := client.Get(ctx, claim.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := claim.Attempts, task.Attempts; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+
+		// effects are committed on done
+		claim, err = client.Claim(ctx, claim.ID, opts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		tx, err = claim.Tx(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pgpq_test_effects (task_id) VALUES ($1)`, claim.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := claim.Done(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exp, got := 1, countEffects(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if _, err := client.Get(ctx, claim.ID); !errors.Is(err, ErrNoTask) {
+			t.Errorf("expected %v, got %v", ErrNoTask, err)
+		}
+	}
+
+	// batch claims apply effects individually
+	if _, err := db.ExecContext(ctx, `TRUNCATE pgpq_test_effects`); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.PushBatch(ctx, []*Task{{}, {}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	batch, err := client.ShiftN(ctx, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer batch.Release(ctx)
+
+	if exp, got := 2, len(batch.Claims); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	tx, err := batch.Claims[0].Tx(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO pgpq_test_effects (task_id) VALUES ($1)`, batch.Claims[0].ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := batch.Claims[0].Bury(ctx, "failed"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// a failure does not abort the batch
+	tx, err = batch.Claims[1].Tx(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT 1/0`); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := batch.Claims[1].Done(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 0, countEffects(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := client.Get(ctx, batch.Claims[0].ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.Get(ctx, batch.Claims[1].ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -9,10 +9,13 @@ import (
 
 	"github.com/benbjohnson/clock"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib" // support pgx connections
 )
 
+// moveBatchSize is the maximum number of tasks moved per statement.
+const moveBatchSize = 1000
+
 // Client implements a queue client.
 type Client struct {
 	db    *sql.DB
@@ -57,8 +60,10 @@ func Wrap(ctx context.Context, db *sql.DB, opts ...ScopeOption) (*Client, error)
 	return c, nil
 }
 
-// Truncate truncates the queue and deletes all tasks. Intended for testing,
-// please use with care.
+// Truncate truncates the queue and deletes all tasks, including buried ones,
+// results, archived tasks, reserved unique keys, schedules, namespace settings
+// and concurrency limits.
+// Intended for testing, please use with care.
 func (c *Client) Truncate(ctx context.Context, opts ...ScopeOption) error {
 	opt := &scopeOptions{Namespace: c.opt.Namespace}
 	opt.set(opts...)
@@ -66,10 +71,37 @@ func (c *Client) Truncate(ctx context.Context, opts ...ScopeOption) error {
 		return err
 	}
 
-	_, err := c.db.ExecContext(ctx, `DELETE FROM pgpq_tasks WHERE namespace = $1`, opt.Namespace)
+	_, err := c.db.ExecContext(ctx, `
+		WITH dead AS (DELETE FROM pgpq_dead_tasks WHERE namespace = $1),
+			results AS (DELETE FROM pgpq_task_results WHERE namespace = $1),
+			archive AS (DELETE FROM pgpq_tasks_archive WHERE namespace = $1),
+			cancellations AS (DELETE FROM pgpq_cancellations WHERE task_id IN (SELECT id FROM pgpq_tasks WHERE namespace = $1)),
+			keys AS (DELETE FROM pgpq_unique_keys WHERE namespace = $1),
+			schedules AS (DELETE FROM pgpq_schedules WHERE namespace = $1),
+			settings AS (DELETE FROM pgpq_namespaces WHERE namespace = $1),
+			slots AS (DELETE FROM pgpq_concurrency_slots WHERE namespace = $1)
+		DELETE FROM pgpq_tasks WHERE namespace = $1
+	`, opt.Namespace)
 	return err
 }
 
+// PurgeUniqueKeys removes expired unique key reservations (see
+// Task.UniqueFor) and returns the number of removed reservations. Expired
+// reservations no longer block pushes, but are retained until purged.
+func (c *Client) PurgeUniqueKeys(ctx context.Context, opts ...ScopeOption) (int64, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	res, err := c.db.ExecContext(ctx, `DELETE FROM pgpq_unique_keys WHERE namespace = $1 AND reserved_until <= $2`, opt.Namespace, c.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // Len returns the queue length. This counts all the non-delayed tasks.
 func (c *Client) Len(ctx context.Context, opts ...ScopeOption) (int64, error) {
 	var cnt int64
@@ -115,100 +147,321 @@ func (c *Client) MinCreatedAt(ctx context.Context, opts ...ScopeOption) (time.Ti
 	return ts.Time, nil
 }
 
-// Push pushes a task into the queue. It may return ErrDuplicateID.
-func (c *Client) Push(ctx context.Context, task *Task) error {
-	if err := task.validate(); err != nil {
-		return err
-	}
+// Push pushes a task into the queue. It may return ErrDuplicateID or
+// ErrDuplicateKey.
+func (c *Client) Push(ctx context.Context, task *Task, opts ...PushOption) error {
+	if len(task.DependsOn) != 0 {
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
 
-	if task.Namespace == "" && c.opt.Namespace != "" {
-		task.Namespace = string(c.opt.Namespace)
+		if err := c.PushTx(ctx, tx, task, opts...); err != nil {
+			return err
+		}
+		return tx.Commit()
 	}
-	if len(task.Payload) == 0 {
-		task.Payload = json.RawMessage{'{', '}'}
+
+	return c.push(ctx, func(ctx context.Context, query string, args ...interface{}) rowScanner {
+		return c.db.QueryRowContext(ctx, query, args...)
+	}, task, opts)
+}
+
+// PushTx pushes a task into the queue as part of a database/sql transaction.
+// The task only becomes visible once tx is committed. It may return
+// ErrDuplicateID or ErrDuplicateKey.
+func (c *Client) PushTx(ctx context.Context, tx *sql.Tx, task *Task, opts ...PushOption) error {
+	return c.push(ctx, func(ctx context.Context, query string, args ...interface{}) rowScanner {
+		return tx.QueryRowContext(ctx, query, args...)
+	}, task, opts)
+}
+
+// PushPgxTx pushes a task into the queue as part of a native pgx transaction.
+// The task only becomes visible once tx is committed. It may return
+// ErrDuplicateID or ErrDuplicateKey.
+func (c *Client) PushPgxTx(ctx context.Context, tx pgx.Tx, task *Task, opts ...PushOption) error {
+	return c.push(ctx, func(ctx context.Context, query string, args ...interface{}) rowScanner {
+		return tx.QueryRow(ctx, query, args...)
+	}, task, opts)
+}
+
+func (c *Client) push(ctx context.Context, queryRow queryRowFunc, task *Task, opts []PushOption) error {
+	if err := c.normTask(task); err != nil {
+		return err
 	}
 
 	now := c.clock.Now()
+	if task.UniqueKey != "" {
+		opt := new(pushOptions)
+		opt.set(opts...)
+		return c.pushUnique(ctx, queryRow, task, opt, now)
+	}
 
-	var row *sql.Row
+	var row rowScanner
 	if task.ID == uuid.Nil {
-		row = c.db.QueryRowContext(ctx, stmtPush, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), now, now)
+		row = queryRow(ctx, stmtPush, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), task.MaxAttempts, now, now)
 	} else {
-		row = c.db.QueryRowContext(ctx, stmtPushWithID, task.ID, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), now, now)
+		row = queryRow(ctx, stmtPushWithID, task.ID, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), task.MaxAttempts, now, now)
 	}
 
 	if err := row.Scan(&task.ID); err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "pgpq_tasks_pkey" {
+		if isDuplicateID(err) {
 			return ErrDuplicateID
 		}
 		return err
 	}
-	return nil
+	return c.pushDeps(ctx, queryRow, task)
+}
+
+func (c *Client) pushDeps(ctx context.Context, queryRow queryRowFunc, task *Task) error {
+	if len(task.DependsOn) == 0 {
+		return nil
+	}
+
+	var n int64
+	return queryRow(ctx, stmtPushDeps, task.ID, task.dependsOn(), task.CancelOnParentFailure).Scan(&n)
 }
 
-// Get returns a task by ID. It may return ErrNoTask.
+func (c *Client) pushUnique(ctx context.Context, queryRow queryRowFunc, task *Task, opt *pushOptions, now time.Time) error {
+	query := stmtPushUnique
+	switch opt.Conflict {
+	case ConflictIgnore:
+		query = stmtPushUniqueIgnore
+	case ConflictReplace:
+		query = stmtPushUniqueReplace
+	}
+
+	id := task.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	requested := id
+
+	row := queryRow(ctx, query, id, task.Namespace, task.Priority, unsafeString(task.Payload), coalesceTime(task.NotBefore, unixZero), task.MaxAttempts, task.UniqueKey, task.uniqueFor(), now)
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) || isDuplicateKey(err) {
+			return ErrDuplicateKey
+		} else if isDuplicateID(err) {
+			return ErrDuplicateID
+		}
+		return err
+	}
+	task.ID = id
+
+	if id != requested {
+		return nil
+	}
+	return c.pushDeps(ctx, queryRow, task)
+}
+
+// Get returns a pending, a completed (see Claim.DoneWithResult) or a buried
+// task by ID. Buried tasks have StatusDead, use GetDead to retrieve the
+// reason. It may return ErrNoTask.
 func (c *Client) Get(ctx context.Context, id uuid.UUID) (*TaskDetails, error) {
 	td := new(TaskDetails)
 	row := c.db.QueryRowContext(ctx, stmtGet, id)
-	if err := td.scan(row); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoTask
+	if err := td.scan(row); errors.Is(err, sql.ErrNoRows) {
+		td, err := c.getResult(ctx, id)
+		if errors.Is(err, ErrNoTask) {
+			dt, err := c.GetDead(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return &dt.TaskDetails, nil
 		}
+		return td, err
+	} else if err != nil {
 		return nil, err
 	}
-	return td, nil
-}
 
-// Claim locks and returns the task with the given ID. It may return ErrNoTask.
-func (c *Client) Claim(ctx context.Context, id uuid.UUID) (*Claim, error) {
-	tx, err := c.db.BeginTx(ctx, nil)
+	rows, err := c.db.QueryContext(ctx, `SELECT parent_id, cancel_on_failure FROM pgpq_task_deps WHERE task_id = $1 ORDER BY parent_id`, id)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	claim := c.newClaim(tx)
-	row := tx.QueryRowContext(ctx, stmtClaim, id)
-	if err := claim.TaskDetails.scan(row); err != nil {
-		_ = tx.Rollback()
+	for rows.Next() {
+		var parentID uuid.UUID
+		if err := rows.Scan(&parentID, &td.CancelOnParentFailure); err != nil {
+			return nil, err
+		}
+		td.DependsOn = append(td.DependsOn, parentID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoTask
+	return td, nil
+}
+
+// Delete removes a task from the queue. It returns ErrClaimed if the task is
+// currently claimed and ErrNoTask if it does not exist.
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	var deleted, existing int64
+	if err := c.db.QueryRowContext(ctx, stmtDelete, id, c.clock.Now()).Scan(&deleted, &existing); err != nil {
+		return err
+	} else if deleted != 0 {
+		return nil
+	} else if existing != 0 {
+		return ErrClaimed
+	}
+	return ErrNoTask
+}
+
+// Cancel removes a task from the queue. If the task is currently claimed, it
+// is flagged as cancelled instead (see Claim.Cancelled) and removed once the
+// claim is released or, if the claim is abandoned, by the next Shift. It may
+// return ErrNoTask.
+func (c *Client) Cancel(ctx context.Context, id uuid.UUID) error {
+	var n int64
+	if err := c.db.QueryRowContext(ctx, stmtCancel, id, c.clock.Now()).Scan(&n); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoTask
+	}
+	return nil
+}
+
+// UpdateWhere applies changes to all tasks matching the filter options in a
+// single statement and returns the number of updated tasks. Tasks which are
+// currently claimed are skipped. The number of tasks is only restricted if
+// WithLimit is given. It may return ErrDuplicateKey if a namespace change
+// conflicts with the unique key of another task.
+func (c *Client) UpdateWhere(ctx context.Context, changes *TaskChanges, opts ...ListOption) (int64, error) {
+	if err := changes.validate(); err != nil {
+		return 0, err
+	}
+
+	opt := &listOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	return c.updateWhere(ctx, changes, opt, sql.NullInt64{Int64: opt.Limit, Valid: opt.Limit > 0}, true)
+}
+
+// MoveNamespace moves all tasks matching the filter options from one namespace
+// to another and returns the number of moved tasks. Tasks are moved in
+// batches, progress (if not nil) is called with the total number of moved
+// tasks after each batch. Tasks which are currently claimed are skipped, so
+// it is safe to run while workers are consuming either namespace. Moved tasks
+// retain their UpdatedAt and thus their position in the queue. Namespace,
+// limit and offset options are ignored. It may return ErrDuplicateKey if a
+// task conflicts with the unique key of a task in the target namespace.
+func (c *Client) MoveNamespace(ctx context.Context, from, to string, progress func(moved int64), opts ...ListOption) (int64, error) {
+	changes := &TaskChanges{Namespace: &to}
+	if err := changes.validate(); err != nil {
+		return 0, err
+	}
+
+	opt := new(listOptions)
+	opt.set(opts...)
+	opt.Namespace, opt.Limit, opt.Offset = namespace(from), 0, 0
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for {
+		n, err := c.updateWhere(ctx, changes, opt, moveBatchSize, false)
+		if err != nil {
+			return moved, err
+		}
+		if n != 0 {
+			// wake up WaitShift, moved tasks are not touched
+			if _, err := c.db.ExecContext(ctx, `SELECT pg_notify($1, '')`, channelOf(to)); err != nil {
+				return moved, err
+			}
+		}
+
+		moved += n
+		if progress != nil {
+			progress(moved)
+		}
+		if n < moveBatchSize || from == to {
+			return moved, nil
+		}
+	}
+}
+
+func (c *Client) updateWhere(ctx context.Context, changes *TaskChanges, opt *listOptions, limit interface{}, touch bool) (int64, error) {
+	now := c.clock.Now()
+	query, args := opt.build(stmtUpdateWhere, limit, now, append(changes.args(), now, touch)...)
+	res, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		if isDuplicateKey(err) {
+			return 0, ErrDuplicateKey
 		}
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Claim locks and returns the task with the given ID and increments its
+// attempts counter. Unlike Shift, Claim ignores the attempts budget and the
+// dependencies of the task. Only lease and archive options are applied. It may
+// return ErrNoTask.
+func (c *Client) Claim(ctx context.Context, id uuid.UUID, opts ...ScopeOption) (*Claim, error) {
+	opt := &scopeOptions{Lease: c.opt.Lease, Archive: c.opt.Archive, WorkerID: c.opt.WorkerID}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
 		return nil, err
 	}
-	return claim, nil
+
+	return c.claim(ctx, opt, stmtClaim, id)
 }
 
-// Shift locks and returns the non-delayed task with the highest priority.
-// It may return ErrNoTask.
+// Shift locks and returns the non-delayed task with the highest priority and
+// increments its attempts counter. Tasks which have exhausted their
+// MaxAttempts are skipped. Multiple namespaces can be consumed using
+// WithNamespaces, WithWeightedNamespaces or WithPrioritizedNamespaces. Tasks
+// of paused namespaces are skipped (see Pause). It may return ErrNoTask or
+// ErrPaused.
 func (c *Client) Shift(ctx context.Context, opts ...ScopeOption) (*Claim, error) {
-	opt := &scopeOptions{Namespace: c.opt.Namespace}
+	opt := &scopeOptions{Namespace: c.opt.Namespace, Lease: c.opt.Lease, Archive: c.opt.Archive, WorkerID: c.opt.WorkerID}
 	opt.set(opts...)
-	if err := opt.validate(); err != nil {
+	if err := opt.validateShift(); err != nil {
 		return nil, err
 	}
 
-	tx, err := c.db.BeginTx(ctx, nil)
-	if err != nil {
+	return c.shift(ctx, opt, true)
+}
+
+// WaitShift is like Shift but blocks until a task can be claimed or ctx is
+// cancelled. Paused namespaces are waited for until they are resumed. It
+// listens for notifications about new and updated tasks and falls back to
+// polling (see WithPollInterval) to pick up delayed tasks and expired leases.
+func (c *Client) WaitShift(ctx context.Context, opts ...ScopeOption) (*Claim, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace, Lease: c.opt.Lease, PollInterval: c.opt.PollInterval, Archive: c.opt.Archive, WorkerID: c.opt.WorkerID}
+	opt.set(opts...)
+	if err := opt.validateShift(); err != nil {
 		return nil, err
 	}
 
-	claim := c.newClaim(tx)
-	row := tx.
-		QueryRowContext(ctx, stmtShift, opt.Namespace, c.clock.Now())
-	if err := claim.TaskDetails.scan(row); err != nil {
-		_ = tx.Rollback()
+	names := opt.getNamespaces()
+	channels := make([]string, 0, len(names))
+	for _, name := range names {
+		channels = append(channels, channelOf(name))
+	}
 
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoTask
+	var claim *Claim
+	err := c.wait(ctx, channels, opt.getPollInterval(), func() (bool, error) {
+		var err error
+		if claim, err = c.shift(ctx, opt, false); errors.Is(err, ErrNoTask) {
+			return false, nil
 		}
+		return err == nil, err
+	})
+	if err != nil {
 		return nil, err
 	}
 	return claim, nil
 }
 
-// List lists all tasks (incl. delayed) in the queue.
+// List lists all tasks (incl. delayed) in the queue. Results can be filtered
+// by list options, e.g. WithPriorityBetween or WithReadyOnly.
 func (c *Client) List(ctx context.Context, opts ...ListOption) ([]*TaskDetails, error) {
 	opt := &listOptions{Namespace: c.opt.Namespace}
 	opt.set(opts...)
@@ -217,7 +470,8 @@ func (c *Client) List(ctx context.Context, opts ...ListOption) ([]*TaskDetails,
 	}
 	limit := opt.getLimit()
 
-	rows, err := c.db.QueryContext(ctx, stmtList, opt.Namespace, limit, opt.Offset)
+	query, args := opt.build(stmtList, limit, c.clock.Now())
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -250,9 +504,122 @@ func (c *Client) Close() error {
 	return err
 }
 
-func (c *Client) newClaim(tx *sql.Tx) *Claim {
-	return &Claim{
-		tx:    tx,
-		clock: c.clock,
+func (c *Client) normTask(task *Task) error {
+	if err := task.validate(); err != nil {
+		return err
+	}
+
+	if task.Namespace == "" && c.opt.Namespace != "" {
+		task.Namespace = string(c.opt.Namespace)
+	}
+	if len(task.Payload) == 0 {
+		task.Payload = json.RawMessage{'{', '}'}
+	}
+	return nil
+}
+
+// shift claims the next task from the namespaces in scope. If checkPaused is
+// set, it returns ErrPaused instead of ErrNoTask when all of them are paused.
+func (c *Client) shift(ctx context.Context, opt *scopeOptions, checkPaused bool) (*Claim, error) {
+	groups := opt.shiftOrder()
+	for _, names := range groups {
+		if claim, err := c.claim(ctx, opt, stmtShift, names); !errors.Is(err, ErrNoTask) {
+			return claim, err
+		}
 	}
+
+	// the best task may belong to a namespace which has reached its
+	// concurrency limit, retry with the remaining namespaces
+	names := opt.getNamespaces()
+	retry := len(groups) == 1 && len(names) > 1
+	for retry || checkPaused {
+		blocked, err := c.blockedNamespaces(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+
+		var paused, full int
+		for _, isPaused := range blocked {
+			if isPaused {
+				paused++
+			} else {
+				full++
+			}
+		}
+		if checkPaused && paused == len(names) {
+			return nil, ErrPaused
+		} else if !retry || full == 0 || len(blocked) == len(names) {
+			break
+		}
+		checkPaused = false
+
+		names = exclude(names, blocked)
+		if claim, err := c.claim(ctx, opt, stmtShift, names); !errors.Is(err, ErrNoTask) {
+			return claim, err
+		}
+	}
+	return nil, ErrNoTask
+}
+
+// blockedNamespaces returns the namespaces which are paused or have reached
+// their concurrency limit, mapped to true if paused.
+func (c *Client) blockedNamespaces(ctx context.Context, names []string) (map[string]bool, error) {
+	rows, err := c.db.QueryContext(ctx, stmtBlockedNamespaces, names, c.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		var paused bool
+		if err := rows.Scan(&name, &paused); err != nil {
+			return nil, err
+		}
+		blocked[name] = blocked[name] || paused
+	}
+	return blocked, rows.Err()
+}
+
+func exclude(names []string, excluded map[string]bool) []string {
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := excluded[name]; !ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func (c *Client) claim(ctx context.Context, opt *scopeOptions, query string, arg interface{}) (*Claim, error) {
+	now := c.clock.Now()
+	claim := &Claim{db: c.db, ttl: opt.Lease, clock: c.clock, archive: opt.Archive, workerID: opt.WorkerID, done: make(chan struct{})}
+	lockedUntil := unixZero
+
+	var row *sql.Row
+	if opt.Lease > 0 {
+		claim.lease = uuid.NullUUID{UUID: uuid.New(), Valid: true}
+		lockedUntil = now.Add(opt.Lease)
+		row = c.db.QueryRowContext(ctx, query, arg, now, claim.lease, lockedUntil)
+	} else {
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		claim.tx = tx
+		row = tx.QueryRowContext(ctx, query, arg, now, claim.lease, lockedUntil)
+	}
+
+	if err := claim.TaskDetails.scan(row); err != nil {
+		if claim.tx != nil {
+			_ = claim.tx.Rollback()
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTask
+		}
+		return nil, err
+	}
+	return claim, nil
 }
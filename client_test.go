@@ -2,13 +2,16 @@ package pgpq_test
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"math/rand"
 	"testing"
 	"time"
 
 	. "github.com/bsm/pgpq"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 func TestClient_Push(t *testing.T) {
@@ -35,6 +38,207 @@ func TestClient_Push_duplicate(t *testing.T) {
 	}
 }
 
+func TestClient_Push_uniqueKey(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	task1 := &Task{UniqueKey: "key", Priority: 1, Payload: json.RawMessage(`{"v":1}`), UniqueFor: time.Hour}
+	if err := client.Push(ctx, task1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// error by default
+	if err := client.Push(ctx, &Task{UniqueKey: "key"}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected %v, got %v", ErrDuplicateKey, err)
+	}
+
+	// keys are scoped by namespace
+	if err := client.Push(ctx, &Task{UniqueKey: "key", Namespace: "baz"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// ignore returns the existing ID
+	task2 := &Task{UniqueKey: "key", Priority: 2}
+	if err := client.Push(ctx, task2, WithConflictMode(ConflictIgnore)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task1.ID, task2.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// replace updates payload and priority
+	task3 := &Task{UniqueKey: "key", Priority: 3, Payload: json.RawMessage(`{"v":3}`)}
+	if err := client.Push(ctx, task3, WithConflictMode(ConflictReplace)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task1.ID, task3.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if td, err := client.Get(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int16(3), td.Priority; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := `{"v": 3}`, string(td.Payload); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := "key", td.UniqueKey; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := time.Hour, td.UniqueFor; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// key stays reserved after done
+	claim, err := client.Claim(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := client.Push(ctx, &Task{UniqueKey: "key"}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected %v, got %v", ErrDuplicateKey, err)
+	}
+
+	task4 := &Task{UniqueKey: "key"}
+	if err := client.Push(ctx, task4, WithConflictMode(ConflictReplace)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task1.ID, task4.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// reservation expires
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		task5 := &Task{UniqueKey: "key"}
+		if err := client.Push(ctx, task5); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if task5.ID == task1.ID {
+			t.Errorf("expected new ID, got %v", task5.ID)
+		}
+	})
+}
+
+func TestClient_PurgeUniqueKeys(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	if err := client.Push(ctx, &Task{UniqueKey: "key", UniqueFor: time.Hour}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := doTaskWith(ctx, func(claim *Claim) error { return claim.Done(ctx) }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n, err := client.PurgeUniqueKeys(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		if n, err := client.PurgeUniqueKeys(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := int64(1), n; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+}
+
+func TestClient_PushTx(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	// rolled back
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := client.PushTx(ctx, tx, &Task{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// committed
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer tx.Rollback()
+
+	task := &Task{}
+	if err := client.PushTx(ctx, tx, task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got, err := client.Len(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp := int64(0); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if tasks, err := client.List(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(tasks); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	} else if exp, got := task.ID, tasks[0].ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_PushPgxTx(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	task := &Task{Priority: 1}
+	if err := client.PushPgxTx(ctx, tx, task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if task.ID == uuid.Nil {
+		t.Errorf("expected ID to be set")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := client.Get(ctx, task.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// duplicate
+	tx, err = conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := client.PushPgxTx(ctx, tx, &Task{ID: task1.ID}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("expected %v, got %v", ErrDuplicateID, err)
+	}
+}
+
 func TestClient_Get(t *testing.T) {
 	ctx := context.Background()
 	task1, _, _ := seedTriple(ctx, t)
@@ -69,14 +273,18 @@ func TestClient_List(t *testing.T) {
 	normTaskDetails(tasks...)
 	assertEqual(t, tasks, []*TaskDetails{
 		{
-			Task:      Task{ID: task1.ID, Priority: 3, Payload: json.RawMessage(`{"foo":1}`), NotBefore: time.Unix(0, 0)},
-			CreatedAt: mockNow,
-			UpdatedAt: mockNow,
+			Task:        Task{ID: task1.ID, Priority: 3, Payload: json.RawMessage(`{"foo":1}`), NotBefore: time.Unix(0, 0)},
+			Status:      StatusPending,
+			LockedUntil: time.Unix(0, 0),
+			CreatedAt:   mockNow,
+			UpdatedAt:   mockNow,
 		},
 		{
-			Task:      Task{ID: task2.ID, Priority: 2, Payload: json.RawMessage(`{"bar":2}`), NotBefore: time.Unix(0, 0)},
-			CreatedAt: mockNow,
-			UpdatedAt: mockNow,
+			Task:        Task{ID: task2.ID, Priority: 2, Payload: json.RawMessage(`{"bar":2}`), NotBefore: time.Unix(0, 0)},
+			Status:      StatusPending,
+			LockedUntil: time.Unix(0, 0),
+			CreatedAt:   mockNow,
+			UpdatedAt:   mockNow,
 		},
 	})
 
@@ -90,9 +298,11 @@ func TestClient_List(t *testing.T) {
 	normTaskDetails(tasks...)
 	assertEqual(t, tasks, []*TaskDetails{
 		{
-			Task:      Task{ID: task3.ID, Namespace: "baz", Payload: json.RawMessage(`{}`), NotBefore: time.Unix(0, 0)},
-			CreatedAt: mockNow,
-			UpdatedAt: mockNow,
+			Task:        Task{ID: task3.ID, Namespace: "baz", Payload: json.RawMessage(`{}`), NotBefore: time.Unix(0, 0)},
+			Status:      StatusPending,
+			LockedUntil: time.Unix(0, 0),
+			CreatedAt:   mockNow,
+			UpdatedAt:   mockNow,
 		},
 	})
 
@@ -102,6 +312,381 @@ func TestClient_List(t *testing.T) {
 	}
 }
 
+func TestClient_List_filters(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	task4 := &Task{Priority: 1, Payload: json.RawMessage(`{"foo":1,"bar":4}`), NotBefore: mockNow.Add(time.Hour)}
+	if err := client.Push(ctx, task4); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		opts []ListOption
+		exp  []uuid.UUID
+	}{
+		{nil, []uuid.UUID{task1.ID, task2.ID, task4.ID}},
+		{[]ListOption{WithPriorityBetween(2, 3)}, []uuid.UUID{task1.ID, task2.ID}},
+		{[]ListOption{WithPriorityBetween(0, 1)}, []uuid.UUID{task4.ID}},
+		{[]ListOption{WithReadyOnly()}, []uuid.UUID{task1.ID, task2.ID}},
+		{[]ListOption{WithDelayedOnly()}, []uuid.UUID{task4.ID}},
+		{[]ListOption{WithNotBeforeBetween(mockNow, time.Time{})}, []uuid.UUID{task4.ID}},
+		{[]ListOption{WithCreatedBetween(mockNow, mockNow.Add(time.Second))}, []uuid.UUID{task1.ID, task2.ID, task4.ID}},
+		{[]ListOption{WithUpdatedBetween(time.Time{}, mockNow)}, nil},
+		{[]ListOption{WithIDs(task2.ID, task4.ID, uuid.New())}, []uuid.UUID{task2.ID, task4.ID}},
+		{[]ListOption{WithIDs()}, nil},
+		{[]ListOption{WithIDPrefix(mockUUID.String()[:8])}, []uuid.UUID{task1.ID}},
+		{[]ListOption{WithPayloadContains(json.RawMessage(`{"foo":1}`))}, []uuid.UUID{task1.ID, task4.ID}},
+		{[]ListOption{WithPayloadContains(json.RawMessage(`{"foo":1}`)), WithReadyOnly()}, []uuid.UUID{task1.ID}},
+	} {
+		tasks, err := client.List(ctx, tc.opts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var got []uuid.UUID
+		for _, td := range tasks {
+			got = append(got, td.ID)
+		}
+		assertEqual(t, got, tc.exp)
+	}
+
+	// invalid filters
+	for _, opt := range []ListOption{
+		WithPriorityBetween(3, 1),
+		WithCreatedBetween(mockNow, mockNow.Add(-time.Hour)),
+		WithIDPrefix("x%"),
+		WithPayloadContains(json.RawMessage(`{`)),
+	} {
+		if _, err := client.List(ctx, opt); err == nil {
+			t.Errorf("expected error")
+		}
+	}
+	if _, err := client.List(ctx, WithReadyOnly(), WithDelayedOnly()); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestClient_List_cursor(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	// tasks with equal priority and timestamps are ordered by ID
+	var exp []uuid.UUID
+	exp = append(exp, task1.ID, task2.ID)
+	for i := 0; i < 3; i++ {
+		task := &Task{ID: uuid.UUID{15: byte(i + 1)}}
+		if err := client.Push(ctx, task); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		exp = append(exp, task.ID)
+	}
+
+	var got []uuid.UUID
+	var opts []ListOption
+	for {
+		tasks, err := client.List(ctx, append(opts, WithLimit(2))...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if len(tasks) == 0 {
+			break
+		}
+		for _, td := range tasks {
+			got = append(got, td.ID)
+		}
+		opts = []ListOption{WithCursor(tasks[len(tasks)-1].Cursor())}
+	}
+	assertEqual(t, got, exp)
+
+	if _, err := client.List(ctx, WithCursor("not a cursor")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	if err := client.Delete(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if err := client.Delete(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	// claimed tasks cannot be deleted
+	for _, opts := range [][]ScopeOption{nil, {WithLease(time.Minute)}} {
+		claim, err := client.Claim(ctx, task2.ID, opts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := client.Delete(ctx, task2.ID); !errors.Is(err, ErrClaimed) {
+			t.Errorf("expected %v, got %v", ErrClaimed, err)
+		}
+		if err := claim.Release(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
+func TestClient_Cancel(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	// unclaimed tasks are removed immediately
+	if err := client.Cancel(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if err := client.Cancel(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	// claimed tasks are flagged and removed on release
+	claim, err := client.Claim(ctx, task2.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cancelled, err := claim.Cancelled(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if cancelled {
+		t.Error("expected claim not to be cancelled")
+	}
+
+	if err := client.Cancel(ctx, task2.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cancelled, err := claim.Cancelled(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if !cancelled {
+		t.Error("expected claim to be cancelled")
+	}
+
+	if err := claim.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(ctx, task2.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
+
+func TestClient_Cancel_lease(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	claim, err := client.Claim(ctx, task1.ID, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Cancel(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claim.Priority = 9
+	if err := claim.Update(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
+
+func TestClient_Cancel_abandoned(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	if _, err := client.Claim(ctx, task1.ID, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Cancel(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the lease expires without the claim being released
+	timeTravel(mockNow.Add(2*time.Minute), func() {
+		if claim, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := task2.ID, claim.ID; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if _, err := client.Claim(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+			t.Errorf("expected %v, got %v", ErrNoTask, err)
+		}
+	})
+
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
+
+func TestClient_Cancel_batch(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	batch, err := client.ShiftN(ctx, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Cancel(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, claim := range batch.Claims {
+		if err := claim.Release(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.Get(ctx, task2.ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestClient_UpdateWhere(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	task4 := &Task{Priority: 1, NotBefore: mockNow.Add(time.Hour)}
+	if err := client.Push(ctx, task4); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// claimed tasks are skipped
+	if _, err := client.Claim(ctx, task1.ID, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := client.UpdateWhere(ctx, &TaskChanges{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	priority := int16(5)
+	if n, err := client.UpdateWhere(ctx, &TaskChanges{Priority: &priority}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(2), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if td, err := client.Get(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int16(3), td.Priority; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if td, err := client.Get(ctx, task4.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int16(5), td.Priority; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// move delayed tasks to now
+	if n, err := client.UpdateWhere(ctx, &TaskChanges{NotBefore: &time.Time{}}, WithDelayedOnly()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(1), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if tasks, err := client.List(ctx, WithDelayedOnly()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 0, len(tasks); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	ns := "baz"
+	if n, err := client.UpdateWhere(ctx, &TaskChanges{Namespace: &ns}, WithIDs()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if n, err := client.UpdateWhere(ctx, &TaskChanges{Namespace: &ns}, WithIDs(task2.ID)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(1), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if tasks, err := client.List(ctx, WithNamespace("baz")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 2, len(tasks); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_MoveNamespace(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	truncateVersions := func() {
+		for _, ns := range []string{"v1", "v2"} {
+			if err := client.Truncate(ctx, WithNamespace(ns)); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+	truncateVersions()
+	defer truncateVersions()
+
+	tasks := make([]*Task, 1500)
+	for i := range tasks {
+		tasks[i] = &Task{Namespace: "v1"}
+	}
+	if err := client.PushBatch(ctx, tasks); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	newer := &Task{Namespace: "v2"}
+	timeTravel(mockNow.Add(time.Hour), func() {
+		if err := client.Push(ctx, newer); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	var progress []int64
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		if n, err := client.MoveNamespace(ctx, "v1", "v2", func(moved int64) { progress = append(progress, moved) }); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := int64(1500), n; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+	assertEqual(t, progress, []int64{1000, 1500})
+
+	if n, err := client.Len(ctx, WithNamespace("v2")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(1501), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// moved tasks keep their position
+	if claim, err := client.Shift(ctx, WithNamespace("v2"), WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if claim.ID == newer.ID {
+		t.Errorf("expected moved task, got %v", claim.ID)
+	} else if exp, got := mockNow, claim.UpdatedAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// claimed tasks are skipped
+	if _, err := client.Claim(ctx, task1.ID, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n, err := client.MoveNamespace(ctx, "", "baz", nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(1), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if td, err := client.Get(ctx, task2.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := "baz", td.Namespace; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
 func TestClient_Claim(t *testing.T) {
 	ctx := context.Background()
 	_, task2, _ := seedTriple(ctx, t)
@@ -235,6 +820,52 @@ func TestClient_Shift_thenDone(t *testing.T) {
 	}
 }
 
+func TestClient_Shift_dependencies(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	parent1, parent2 := &Task{}, &Task{}
+	for _, task := range []*Task{parent1, parent2} {
+		if err := client.Push(ctx, task); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	child := &Task{Priority: 9, DependsOn: []uuid.UUID{parent1.ID, parent2.ID, uuid.New()}}
+	if err := client.Push(ctx, child); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if td, err := client.Get(ctx, child.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 3, len(td.DependsOn); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// child is blocked until both parents are done
+	for i := 0; i < 2; i++ {
+		claim, err := client.Shift(ctx)
+		if err != nil {
+			t.Fatalf("[%d] expected no error, got %v", i, err)
+		} else if claim.ID == child.ID {
+			t.Fatalf("[%d] expected child to be blocked", i)
+		}
+		if err := claim.Done(ctx); err != nil {
+			t.Fatalf("[%d] expected no error, got %v", i, err)
+		}
+	}
+
+	claim, err := client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim.Release(ctx)
+
+	if exp, got := child.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
 func TestClient_Shift_delayed(t *testing.T) {
 	later := mockNow.Add(time.Minute)
 	ctx := context.Background()
@@ -262,6 +893,232 @@ func TestClient_Shift_delayed(t *testing.T) {
 	})
 }
 
+func TestClient_Shift_maxAttempts(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	task := &Task{MaxAttempts: 2}
+	if err := client.Push(ctx, task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	child := &Task{DependsOn: []uuid.UUID{task.ID}, CancelOnParentFailure: true}
+	if err := client.Push(ctx, child); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		claim, err := client.Shift(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exp, got := int32(i), claim.Attempts; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if err := claim.Release(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// attempts exhausted, task and child are buried
+	if _, err := client.Shift(ctx); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if n, err := client.Len(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if dt, err := client.GetDead(ctx, task.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int32(2), dt.Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := "max attempts exceeded", dt.Reason; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if dt, err := client.GetDead(ctx, child.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := "parent "+task.ID.String()+" failed", dt.Reason; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_Shift_namespaces(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, task3 := seedTriple(ctx, t)
+
+	truncateQux := func() {
+		if err := client.Truncate(ctx, WithNamespace("qux")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	truncateQux()
+	defer truncateQux()
+
+	task4 := &Task{Namespace: "qux", Priority: 5}
+	if err := client.Push(ctx, task4); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i, tc := range []struct {
+		opt ScopeOption
+		exp uuid.UUID
+	}{
+		{WithNamespaces("", "qux"), task4.ID},
+		{WithPrioritizedNamespaces("baz", ""), task3.ID},
+		{WithPrioritizedNamespaces("baz", ""), task1.ID},
+		{WithWeightedNamespaces(map[string]int{"": 1, "baz": 1}), task2.ID},
+	} {
+		claim, err := client.Shift(ctx, tc.opt, WithLease(time.Minute))
+		if err != nil {
+			t.Fatalf("[%d] expected no error, got %v", i, err)
+		} else if exp, got := tc.exp, claim.ID; exp != got {
+			t.Errorf("[%d] expected %v, got %v", i, exp, got)
+		}
+	}
+
+	if _, err := client.Shift(ctx, WithWeightedNamespaces(map[string]int{"": 1, "baz": 1})); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.Shift(ctx, WithWeightedNamespaces(map[string]int{"": 0})); err == nil {
+		t.Errorf("expected error")
+	}
+	for _, weights := range []map[string]int{nil, {}} {
+		if _, err := client.Shift(ctx, WithWeightedNamespaces(weights)); err == nil {
+			t.Errorf("expected error")
+		}
+	}
+	if _, err := client.ShiftN(ctx, 2, WithNamespaces("", "qux")); err == nil {
+		t.Errorf("expected error")
+	}
+
+	// other methods reject multiple namespaces
+	if err := client.Truncate(ctx, WithNamespaces("qux")); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := client.Len(ctx, WithPrioritizedNamespaces("", "qux")); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := Wrap(ctx, nil, WithWeightedNamespaces(map[string]int{"qux": 1})); err == nil {
+		t.Errorf("expected error")
+	}
+	if n, err := client.Len(ctx, WithNamespace("qux")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(1), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	names, weights := []string{"a", "b", "c"}, []int{1, 3, 6}
+
+	first := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		shuffled := WeightedShuffle(names, weights, rnd.Intn)
+		if exp, got := 3, len(shuffled); exp != got {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+		first[shuffled[0]]++
+	}
+
+	// names come first in proportion to their weight
+	for i, name := range names {
+		if exp, got := weights[i]*1000, first[name]; got < exp-200 || got > exp+200 {
+			t.Errorf("expected %q first ~%v times, got %v", name, exp, got)
+		}
+	}
+
+	// inputs are not modified
+	assertEqual(t, names, []string{"a", "b", "c"})
+	assertEqual(t, weights, []int{1, 3, 6})
+}
+
+func TestClient_Shift_lease(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	// lease task #1
+	claim1, err := client.Shift(ctx, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim1.Release(ctx)
+
+	if exp, got := task1.ID, claim1.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := mockNow.Add(time.Minute), claim1.LockedUntil; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// task #1 is leased, shift task #2
+	claim2, err := client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim2.Release(ctx)
+
+	if exp, got := task2.ID, claim2.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// lease expires, task #1 becomes visible again
+	timeTravel(mockNow.Add(2*time.Minute), func() {
+		claim3, err := client.Shift(ctx, WithLease(time.Minute))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer claim3.Release(ctx)
+
+		if exp, got := task1.ID, claim3.ID; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		} else if exp, got := int32(2), claim3.Attempts; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+
+		// original lease is lost
+		if err := claim1.Done(ctx); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("expected %v, got %v", ErrLeaseLost, err)
+		}
+
+		if err := claim3.Done(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestClient_WaitShift(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	// times out when queue is empty
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.WaitShift(tctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// wakes up on push
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = client.Push(ctx, &Task{ID: mockUUID})
+	}()
+
+	start := time.Now()
+	claim, err := client.WaitShift(ctx, WithPollInterval(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim.Release(ctx)
+
+	if exp, got := mockUUID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected to be notified, took %v", elapsed)
+	}
+}
+
 func TestClient_Len(t *testing.T) {
 	ctx := context.Background()
 	seedTriple(ctx, t)
@@ -400,11 +1257,15 @@ func TestClient_MinCreatedAt_delayed(t *testing.T) {
 }
 
 func doTask(ctx context.Context) error {
+	return doTaskWith(ctx, func(claim *Claim) error { return claim.Done(ctx) })
+}
+
+func doTaskWith(ctx context.Context, fn func(*Claim) error) error {
 	claim, err := client.Shift(ctx)
 	if err != nil {
 		return err
 	}
 	defer claim.Release(ctx)
 
-	return claim.Done(ctx)
+	return fn(claim)
 }
@@ -0,0 +1,123 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadTask contains information about a buried task.
+type DeadTask struct {
+	TaskDetails
+	Reason   string
+	FailedAt time.Time
+}
+
+func (dt *DeadTask) scan(rows rowScanner) error {
+	var uniqueKey sql.NullString
+	var uniqueFor int64
+	if err := rows.Scan(
+		&dt.ID,
+		&dt.Namespace,
+		&dt.Priority,
+		&dt.Payload,
+		&dt.NotBefore,
+		&dt.MaxAttempts,
+		&uniqueKey,
+		&uniqueFor,
+		&dt.Attempts,
+		&dt.CreatedAt,
+		&dt.UpdatedAt,
+		&dt.Reason,
+		&dt.FailedAt,
+	); err != nil {
+		return err
+	}
+	dt.UniqueKey = uniqueKey.String
+	dt.UniqueFor = time.Duration(uniqueFor) * time.Microsecond
+	dt.Status = StatusDead
+	dt.FinishedAt = dt.FailedAt
+	return nil
+}
+
+// GetDead returns a buried task by ID. It may return ErrNoTask.
+func (c *Client) GetDead(ctx context.Context, id uuid.UUID) (*DeadTask, error) {
+	dt := new(DeadTask)
+	row := c.db.QueryRowContext(ctx, stmtGetDead, id)
+	if err := dt.scan(row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTask
+		}
+		return nil, err
+	}
+	return dt, nil
+}
+
+// ListDead lists all buried tasks.
+func (c *Client) ListDead(ctx context.Context, opts ...ListOption) ([]*DeadTask, error) {
+	opt := &listOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	limit := opt.getLimit()
+
+	query, args := opt.build(stmtListDead, limit, c.clock.Now())
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*DeadTask, 0, limit)
+	for rows.Next() {
+		task := new(DeadTask)
+		if err := task.scan(rows); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// RequeueDead moves a buried task back into the queue and resets its
+// attempts. Dependencies (see Task.DependsOn) are removed when a task is
+// buried and are not restored, so the requeued task can be shifted
+// immediately, even if its parents are still pending or buried. It may return
+// ErrNoTask, ErrDuplicateID or ErrDuplicateKey.
+func (c *Client) RequeueDead(ctx context.Context, id uuid.UUID) error {
+	if err := c.db.QueryRowContext(ctx, stmtRequeueDead, id, c.clock.Now()).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoTask
+		} else if isDuplicateID(err) {
+			return ErrDuplicateID
+		} else if isDuplicateKey(err) {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeDead permanently deletes buried tasks which failed more than olderThan
+// ago. It returns the number of deleted tasks.
+func (c *Client) PurgeDead(ctx context.Context, olderThan time.Duration, opts ...ScopeOption) (int64, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	res, err := c.db.ExecContext(ctx, stmtPurgeDead, opt.Namespace, c.clock.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,227 @@
+package pgpq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+	"github.com/google/uuid"
+)
+
+func TestClaim_Bury(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	claim, err := client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim.Release(ctx)
+
+	if err := claim.Bury(ctx, "boom"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if td, err := client.Get(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := StatusDead, td.Status; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := mockNow, td.FinishedAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	dt, err := client.GetDead(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := "boom", dt.Reason; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := int32(1), dt.Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := mockNow, dt.FailedAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if _, err := client.GetDead(ctx, uuid.New()); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
+
+func TestClaim_Bury_dependencies(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	parent := &Task{}
+	if err := client.Push(ctx, parent); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cancelled := &Task{DependsOn: []uuid.UUID{parent.ID}, CancelOnParentFailure: true}
+	blocked := &Task{DependsOn: []uuid.UUID{parent.ID}}
+	if err := client.PushBatch(ctx, []*Task{cancelled, blocked}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	grandchild := &Task{DependsOn: []uuid.UUID{cancelled.ID}, CancelOnParentFailure: true}
+	if err := client.Push(ctx, grandchild); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claim, err := client.Claim(ctx, parent.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Bury(ctx, "boom"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// cancelled descendants are buried
+	for _, task := range []*Task{cancelled, grandchild} {
+		if dt, err := client.GetDead(ctx, task.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := "parent "+parent.ID.String()+" failed", dt.Reason; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	}
+
+	// blocked child remains in the queue
+	if _, err := client.Shift(ctx); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	// until the parent is requeued and done
+	if err := client.RequeueDead(ctx, parent.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	claim, err = client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := parent.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if err := claim.Done(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claim, err = client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim.Release(ctx)
+
+	if exp, got := blocked.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClaim_Fail(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	task := &Task{MaxAttempts: 2}
+	if err := client.Push(ctx, task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		claim, err := client.Shift(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := claim.Fail(ctx, "boom"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if tasks, err := client.List(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 0, len(tasks); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if dead, err := client.ListDead(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(dead); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := task.ID, dead[0].ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_RequeueDead(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	if err := doTaskWith(ctx, func(claim *Claim) error { return claim.Bury(ctx, "boom") }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := client.RequeueDead(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.RequeueDead(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	if td, err := client.Get(ctx, task1.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int32(0), td.Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_RequeueDead_dependencies(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	parent := &Task{}
+	if err := client.Push(ctx, parent); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	child := &Task{DependsOn: []uuid.UUID{parent.ID}, CancelOnParentFailure: true}
+	if err := client.Push(ctx, child); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := doTaskWith(ctx, func(claim *Claim) error { return claim.Bury(ctx, "boom") }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// dependencies are not restored
+	if err := client.RequeueDead(ctx, child.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	claim, err := client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer claim.Release(ctx)
+
+	if exp, got := child.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_PurgeDead(t *testing.T) {
+	ctx := context.Background()
+	seedTriple(ctx, t)
+
+	if err := doTaskWith(ctx, func(claim *Claim) error { return claim.Bury(ctx, "boom") }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n, err := client.PurgeDead(ctx, time.Hour); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		if n, err := client.PurgeDead(ctx, time.Hour); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := int64(1), n; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+}
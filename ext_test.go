@@ -24,3 +24,13 @@ func (c *Client) SetCurrentTime(t time.Time) {
 	clk.Set(t)
 	c.clock = clk
 }
+
+// AddTime advances the (mock) current time of this Claim.
+func (tc *Claim) AddTime(d time.Duration) {
+	tc.clock.(*clock.Mock).Add(d)
+}
+
+// WeightedShuffle exposes weightedShuffle for testing.
+func WeightedShuffle(names []string, weights []int, intn func(int) int) []string {
+	return weightedShuffle(names, weights, intn)
+}
@@ -7,6 +7,7 @@ require (
 	github.com/benbjohnson/clock v1.3.0
 	github.com/google/uuid v1.3.0
 	github.com/jackc/pgx/v5 v5.3.1
+	github.com/robfig/cron/v3 v3.0.1
 )
 
 require (
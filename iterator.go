@@ -0,0 +1,131 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// iterateChunkSize is the number of tasks fetched from the cursor at once.
+const iterateChunkSize = 100
+
+// Iterator streams tasks from a server-side cursor. Tasks are fetched in
+// chunks, so memory usage is independent of the number of iterated tasks. The
+// iterator holds an open transaction and must be closed after use.
+type Iterator struct {
+	ctx  context.Context
+	tx   *sql.Tx
+	buf  []*TaskDetails
+	cur  *TaskDetails
+	done bool
+	err  error
+}
+
+// Iterate iterates over all tasks, using the same order and options as List.
+// Unlike List, the number of tasks is only restricted if WithLimit is given.
+//
+//	it := client.Iterate(ctx)
+//	defer it.Close()
+//
+//	for it.Next() {
+//		task := it.Task()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func (c *Client) Iterate(ctx context.Context, opts ...ListOption) *Iterator {
+	it := &Iterator{ctx: ctx}
+
+	opt := &listOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		it.fail(err)
+		return it
+	}
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		it.fail(err)
+		return it
+	}
+	it.tx = tx
+
+	query, args := opt.build(stmtList, sql.NullInt64{Int64: opt.Limit, Valid: opt.Limit > 0}, c.clock.Now())
+	if _, err := tx.ExecContext(ctx, `DECLARE pgpq_iterate NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		it.fail(err)
+	}
+	return it
+}
+
+// Next advances the iterator to the next task. It returns false when the
+// iteration is complete or an error occurred.
+func (it *Iterator) Next() bool {
+	if len(it.buf) == 0 && !it.done {
+		it.fetch()
+	}
+	if len(it.buf) == 0 {
+		it.cur = nil
+		return false
+	}
+
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Task returns the current task.
+func (it *Iterator) Task() *TaskDetails {
+	return it.cur
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close closes the iterator and releases the underlying transaction.
+func (it *Iterator) Close() error {
+	it.done = true
+	it.buf = nil
+	it.cur = nil
+
+	if it.tx == nil {
+		return nil
+	}
+
+	tx := it.tx
+	it.tx = nil
+	return tx.Rollback()
+}
+
+func (it *Iterator) fetch() {
+	rows, err := it.tx.QueryContext(it.ctx, `FETCH `+strconv.Itoa(iterateChunkSize)+` FROM pgpq_iterate`)
+	if err != nil {
+		it.fail(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task := new(TaskDetails)
+		if err := task.scan(rows); err != nil {
+			it.fail(err)
+			return
+		}
+		it.buf = append(it.buf, task)
+	}
+	if err := rows.Err(); err != nil {
+		it.fail(err)
+		return
+	}
+
+	if len(it.buf) < iterateChunkSize {
+		it.done = true
+	}
+}
+
+func (it *Iterator) fail(err error) {
+	it.err = err
+	it.done = true
+	it.buf = nil
+}
@@ -0,0 +1,61 @@
+package pgpq_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/bsm/pgpq"
+)
+
+func TestClient_Iterate(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	tasks := make([]*Task, 250)
+	for i := range tasks {
+		tasks[i] = &Task{}
+	}
+	if err := client.PushBatch(ctx, tasks); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	count := func(opts ...ListOption) (n int, first *TaskDetails) {
+		t.Helper()
+
+		it := client.Iterate(ctx, opts...)
+		defer it.Close()
+
+		for it.Next() {
+			if first == nil {
+				first = it.Task()
+			}
+			n++
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return
+	}
+
+	if n, first := count(); n != 252 {
+		t.Errorf("expected %v, got %v", 252, n)
+	} else if exp, got := task1.ID, first.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if n, _ := count(WithLimit(120)); n != 120 {
+		t.Errorf("expected %v, got %v", 120, n)
+	}
+	if n, _ := count(WithNamespace("baz")); n != 1 {
+		t.Errorf("expected %v, got %v", 1, n)
+	}
+
+	it := client.Iterate(ctx, WithPriorityBetween(3, 1))
+	if it.Next() {
+		t.Error("expected no tasks")
+	} else if it.Err() == nil {
+		t.Error("expected error")
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
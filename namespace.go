@@ -0,0 +1,107 @@
+package pgpq
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// agingBatchSize is the maximum number of tasks updated per statement by
+// SetAging.
+const agingBatchSize = 1000
+
+// SetAging enables priority aging for a namespace. The effective priority of
+// a task increases by 1 for every interval it has been waiting since it was
+// last pushed or updated, so old low-priority tasks are eventually shifted
+// ahead of new high-priority ones. A zero interval disables aging. When
+// shifting from multiple namespaces (see WithNamespaces), effective priorities
+// are compared across namespaces, with or without aging.
+//
+// Queued tasks are updated in batches and without waiting for row locks.
+// Tasks which are claimed without a lease (see WithLease) while SetAging runs
+// are skipped and keep their previous order until they are updated again.
+// Calling SetAging again with the same interval only updates such tasks.
+func (c *Client) SetAging(ctx context.Context, ns string, interval time.Duration) error {
+	if err := namespace(ns).validate(); err != nil {
+		return err
+	} else if interval < 0 {
+		return fmt.Errorf("aging interval %v must not be negative", interval)
+	}
+
+	if _, err := c.db.ExecContext(ctx, stmtSetAging, ns, interval.Microseconds(), c.clock.Now()); err != nil {
+		return err
+	}
+
+	for {
+		res, err := c.db.ExecContext(ctx, stmtAgeTasks, ns, interval.Microseconds(), agingBatchSize)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		} else if n < agingBatchSize {
+			return nil
+		}
+	}
+}
+
+// Pause pauses a namespace. Tasks of paused namespaces are skipped by Shift,
+// ShiftN and WaitShift, but can still be pushed, listed and claimed by ID.
+func (c *Client) Pause(ctx context.Context, ns string) error {
+	return c.setPaused(ctx, ns, true)
+}
+
+// Resume resumes a paused namespace.
+func (c *Client) Resume(ctx context.Context, ns string) error {
+	return c.setPaused(ctx, ns, false)
+}
+
+// Paused returns true if a namespace is paused.
+func (c *Client) Paused(ctx context.Context, ns string) (bool, error) {
+	var paused bool
+	if err := c.db.QueryRowContext(ctx, stmtPaused, ns).Scan(&paused); err != nil {
+		return false, err
+	}
+	return paused, nil
+}
+
+func (c *Client) setPaused(ctx context.Context, ns string, paused bool) error {
+	if err := namespace(ns).validate(); err != nil {
+		return err
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, stmtSetPaused, ns, paused, c.clock.Now()); err != nil {
+		return err
+	}
+	if !paused {
+		// wake up WaitShift
+		if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, '')`, channelOf(ns)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetConcurrencyLimit limits the number of concurrently claimed tasks of a
+// namespace across all clients. Once the limit is reached, Shift, ShiftN and
+// WaitShift skip the tasks of the namespace until claims are released or
+// their leases expire. Claim ignores the limit. A zero limit removes the limit.
+// Lowering the limit blocks until the claims holding the removed slots are
+// released.
+func (c *Client) SetConcurrencyLimit(ctx context.Context, ns string, limit int) error {
+	if err := namespace(ns).validate(); err != nil {
+		return err
+	} else if limit < 0 {
+		return fmt.Errorf("concurrency limit %d must not be negative", limit)
+	}
+
+	_, err := c.db.ExecContext(ctx, stmtSetConcurrencyLimit, ns, limit)
+	return err
+}
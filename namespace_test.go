@@ -0,0 +1,240 @@
+package pgpq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+	"github.com/google/uuid"
+)
+
+func TestClient_SetAging(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	shiftAll := func() (ids []uuid.UUID) {
+		t.Helper()
+
+		for {
+			claim, err := client.Shift(ctx)
+			if errors.Is(err, ErrNoTask) {
+				return
+			} else if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			ids = append(ids, claim.ID)
+			if err := claim.Release(ctx); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+
+	if err := client.SetAging(ctx, "", -time.Minute); err == nil {
+		t.Fatal("expected error")
+	}
+
+	taskA := &Task{MaxAttempts: 1}
+	if err := client.Push(ctx, taskA); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var taskB, taskC *Task
+	timeTravel(mockNow.Add(30*time.Minute), func() {
+		taskB = &Task{Priority: 2, MaxAttempts: 1}
+		taskC = &Task{Priority: 5, MaxAttempts: 1}
+		if err := client.Push(ctx, taskB); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := client.Push(ctx, taskC); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := client.SetAging(ctx, "", 10*time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertEqual(t, shiftAll(), []uuid.UUID{taskC.ID, taskA.ID, taskB.ID})
+	})
+}
+
+func TestClient_SetAging_claimed(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	timeTravel(mockNow.Add(30*time.Minute), func() {
+		task4 := &Task{Priority: 4}
+		if err := client.Push(ctx, task4); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// claimed tasks do not block SetAging
+		claim, err := client.Claim(ctx, task2.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := client.SetAging(sctx, "", 10*time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := claim.Release(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// skipped tasks are updated by the next call
+		if err := client.SetAging(ctx, "", 10*time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// aged priorities: 6, 5 and 4
+		for i, exp := range []uuid.UUID{task1.ID, task2.ID, task4.ID} {
+			if claim, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+				t.Fatalf("[%d] expected no error, got %v", i, err)
+			} else if got := claim.ID; exp != got {
+				t.Errorf("[%d] expected %v, got %v", i, exp, got)
+			}
+		}
+	})
+}
+
+func TestClient_SetAging_namespaces(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	if err := client.SetAging(ctx, "", 10*time.Minute); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// effective priorities after 30m: 100, 3 and 2
+	taskX := &Task{Namespace: "baz", Priority: 100}
+	taskY := &Task{}
+	taskZ := &Task{Namespace: "baz", Priority: 2}
+	for _, task := range []*Task{taskX, taskY, taskZ} {
+		if err := client.Push(ctx, task); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	timeTravel(mockNow.Add(30*time.Minute), func() {
+		for i, exp := range []uuid.UUID{taskX.ID, taskY.ID, taskZ.ID} {
+			if claim, err := client.Shift(ctx, WithNamespaces("", "baz"), WithLease(time.Minute)); err != nil {
+				t.Fatalf("[%d] expected no error, got %v", i, err)
+			} else if got := claim.ID; exp != got {
+				t.Errorf("[%d] expected %v, got %v", i, exp, got)
+			}
+		}
+	})
+}
+
+func TestClient_Pause(t *testing.T) {
+	ctx := context.Background()
+	task1, _, task3 := seedTriple(ctx, t)
+
+	if err := client.Pause(ctx, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if paused, err := client.Paused(ctx, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if !paused {
+		t.Error("expected namespace to be paused")
+	}
+	if paused, err := client.Paused(ctx, "baz"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if paused {
+		t.Error("expected namespace not to be paused")
+	}
+
+	// push is still accepted
+	if err := client.Push(ctx, &Task{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Shift(ctx); !errors.Is(err, ErrPaused) {
+		t.Errorf("expected %v, got %v", ErrPaused, err)
+	}
+	if _, err := client.Shift(ctx, WithNamespaces("", "")); !errors.Is(err, ErrPaused) {
+		t.Errorf("expected %v, got %v", ErrPaused, err)
+	}
+	if claim, err := client.Shift(ctx, WithNamespaces("", "baz"), WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task3.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if err := client.Resume(ctx, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if claim, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task1.ID, claim.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_SetConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	_, _, task3 := seedTriple(ctx, t)
+
+	if err := client.SetConcurrencyLimit(ctx, "", -1); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := client.SetConcurrencyLimit(ctx, "", 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// lease-based claims
+	claim, err := client.Shift(ctx, WithLease(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Shift(ctx, WithLease(time.Minute)); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.Shift(ctx); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if err := claim.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// transaction-based claims
+	claim, err = client.Shift(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Shift(ctx, WithLease(time.Minute)); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+	if _, err := client.ShiftN(ctx, 2); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+
+	// other namespaces are not affected, even if the limited namespace has
+	// tasks with a higher priority
+	if other, err := client.Shift(ctx, WithNamespaces("", "baz"), WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := task3.ID, other.ID; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if err := claim.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// expired leases free their slot
+	if _, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	timeTravel(mockNow.Add(2*time.Minute), func() {
+		if _, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	if err := client.SetConcurrencyLimit(ctx, "", 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Shift(ctx, WithLease(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package pgpq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// wait calls check until it returns true, an error or ctx is cancelled. In
+// between, it waits for a notification on any of the channels or for interval
+// to elapse. Connections that do not support notifications fall back to
+// polling.
+func (c *Client) wait(ctx context.Context, channels []string, interval time.Duration, check func() (bool, error)) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pc, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return poll(ctx, interval, check)
+		}
+
+		pgc := pc.Conn()
+		for _, channel := range channels {
+			channel := channel
+			if _, err := pgc.Exec(ctx, "LISTEN "+channel); err != nil {
+				return err
+			}
+			defer func() { _, _ = pgc.Exec(context.Background(), "UNLISTEN "+channel) }()
+		}
+
+		for {
+			if ok, err := check(); err != nil || ok {
+				return err
+			}
+
+			wctx, cancel := context.WithTimeout(ctx, interval)
+			_, err := pgc.WaitForNotification(wctx)
+			cancel()
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			} else if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+		}
+	})
+}
+
+func poll(ctx context.Context, interval time.Duration, check func() (bool, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ok, err := check(); err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
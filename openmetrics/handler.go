@@ -14,6 +14,7 @@ import (
 type Client interface {
 	Len(context.Context, ...pgpq.ScopeOption) (int64, error)
 	MinCreatedAt(context.Context, ...pgpq.ScopeOption) (time.Time, error)
+	Paused(context.Context, string) (bool, error)
 }
 
 // NewHandler constructs a new handler to serve queue metrics in OpenMetrics format.
@@ -37,7 +38,7 @@ type handler struct {
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	lens, ages, err := h.fetchStats(r.Context(), time.Now())
+	lens, ages, paused, err := h.fetchStats(r.Context(), time.Now())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -56,26 +57,43 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	for i, ns := range h.namespaces {
 		_, _ = fmt.Fprintf(w, "queue_oldest_message_age_seconds{namespace=%q} %d\n", ns, ages[i])
 	}
+
+	_, _ = fmt.Fprintf(w, "# TYPE queue_paused gauge\n")
+	_, _ = fmt.Fprintf(w, "# HELP queue_paused Whether consumption of the namespace is paused.\n")
+	for i, ns := range h.namespaces {
+		_, _ = fmt.Fprintf(w, "queue_paused{namespace=%q} %d\n", ns, paused[i])
+	}
 }
 
-func (h *handler) fetchStats(ctx context.Context, now time.Time) (lens, ages []int64, _ error) {
+func (h *handler) fetchStats(ctx context.Context, now time.Time) (lens, ages, paused []int64, _ error) {
 	lens = make([]int64, 0, len(h.namespaces))
 	ages = make([]int64, 0, len(h.namespaces))
+	paused = make([]int64, 0, len(h.namespaces))
 	for _, ns := range h.namespaces {
 		n, err := h.client.Len(ctx, pgpq.WithNamespace(ns))
 		if err != nil {
-			return nil, nil, fmt.Errorf("len: %w", err)
+			return nil, nil, nil, fmt.Errorf("len: %w", err)
 		}
 		lens = append(lens, n)
 
 		createdAt, err := h.client.MinCreatedAt(ctx, pgpq.WithNamespace(ns))
 		if err != nil {
-			return nil, nil, fmt.Errorf("age: %w", err)
+			return nil, nil, nil, fmt.Errorf("age: %w", err)
 		}
 		age := now.Sub(createdAt).Seconds()
 		ages = append(ages, int64(age))
+
+		ok, err := h.client.Paused(ctx, ns)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("paused: %w", err)
+		}
+		if ok {
+			paused = append(paused, 1)
+		} else {
+			paused = append(paused, 0)
+		}
 	}
-	return lens, ages, nil
+	return lens, ages, paused, nil
 }
 
 // ----------------------------------------------------------------------------
@@ -0,0 +1,51 @@
+package openmetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/pgpq"
+)
+
+func TestHandler(t *testing.T) {
+	client := &mockClient{paused: map[string]bool{"b": true}}
+	handler := NewHandler(client, "b", "a")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if exp, got := http.StatusOK, w.Code; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for _, line := range []string{
+		`queue_len{namespace="a"} 3`,
+		`queue_len{namespace="b"} 3`,
+		"# TYPE queue_paused gauge",
+		`queue_paused{namespace="a"} 0`,
+		`queue_paused{namespace="b"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("expected %q to contain %q", w.Body.String(), line)
+		}
+	}
+}
+
+type mockClient struct {
+	paused map[string]bool
+}
+
+func (*mockClient) Len(context.Context, ...pgpq.ScopeOption) (int64, error) {
+	return 3, nil
+}
+
+func (*mockClient) MinCreatedAt(context.Context, ...pgpq.ScopeOption) (time.Time, error) {
+	return time.Now().Add(-time.Minute), nil
+}
+
+func (m *mockClient) Paused(_ context.Context, ns string) (bool, error) {
+	return m.paused[ns], nil
+}
@@ -1,20 +1,44 @@
 package pgpq
 
 import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
 	// ErrDuplicateID occurs when a task with the same ID already exists.
 	ErrDuplicateID = errors.New("duplicate ID")
+	// ErrDuplicateKey occurs when the unique key of a task is already taken.
+	ErrDuplicateKey = errors.New("duplicate key")
 	// ErrNoTask is returned when tasks cannot be found.
 	ErrNoTask = errors.New("no task")
+	// ErrLeaseLost is returned when a lease-based claim has expired and the
+	// task has been claimed by someone else or removed from the queue.
+	ErrLeaseLost = errors.New("lease lost")
+	// ErrClaimed is returned when a task cannot be deleted because it is
+	// currently claimed.
+	ErrClaimed = errors.New("task claimed")
+	// ErrBuried is returned by Await when the task was buried.
+	ErrBuried = errors.New("task buried")
+	// ErrNoSchedule is returned when schedules cannot be found.
+	ErrNoSchedule = errors.New("no schedule")
+	// ErrPaused is returned by Shift when all namespaces in scope are paused.
+	ErrPaused = errors.New("namespace paused")
 )
 
 // ----------------------------------------------------------------------------
@@ -23,6 +47,18 @@ type listOptions struct {
 	Offset    int64
 	Limit     int64
 	Namespace namespace
+
+	Priority        *priorityRange
+	CreatedAt       timeRange
+	UpdatedAt       timeRange
+	NotBefore       timeRange
+	ReadyOnly       bool
+	DelayedOnly     bool
+	IDs             []uuid.UUID
+	IDPrefix        string
+	PayloadContains json.RawMessage
+	Cursor          *cursor
+	cursorErr       error
 }
 
 func (o *listOptions) getLimit() int64 {
@@ -39,9 +75,104 @@ func (o *listOptions) set(opts ...ListOption) {
 }
 
 func (o *listOptions) validate() error {
+	if o.Priority != nil && o.Priority.Min > o.Priority.Max {
+		return fmt.Errorf("priority range %d..%d is invalid", o.Priority.Min, o.Priority.Max)
+	}
+	for _, r := range []timeRange{o.CreatedAt, o.UpdatedAt, o.NotBefore} {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	if o.ReadyOnly && o.DelayedOnly {
+		return fmt.Errorf("ready-only and delayed-only are mutually exclusive")
+	}
+	for i := 0; i < len(o.IDPrefix); i++ {
+		if c := o.IDPrefix[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') && c != '-' {
+			return fmt.Errorf("ID prefix %q must only contain lower-case hex characters", o.IDPrefix)
+		}
+	}
+	if len(o.PayloadContains) != 0 && !json.Valid(o.PayloadContains) {
+		return fmt.Errorf("payload filter %q is not valid JSON", o.PayloadContains)
+	}
+	if o.cursorErr != nil {
+		return o.cursorErr
+	}
 	return o.Namespace.validate()
 }
 
+// build composes the conditions into query and returns it along with the
+// arguments. Limit and offset are always passed as $1 and $2, followed by
+// extra.
+func (o *listOptions) build(query string, limit interface{}, now time.Time, extra ...interface{}) (string, []interface{}) {
+	args := append([]interface{}{limit, o.Offset}, extra...)
+	conds := make([]string, 0, 4)
+	add := func(format string, vals ...interface{}) {
+		refs := make([]interface{}, 0, len(vals))
+		for _, v := range vals {
+			args = append(args, v)
+			refs = append(refs, "$"+strconv.Itoa(len(args)))
+		}
+		conds = append(conds, fmt.Sprintf(format, refs...))
+	}
+
+	add("namespace = %s", o.Namespace)
+	if o.Priority != nil {
+		add("priority >= %s", o.Priority.Min)
+		add("priority <= %s", o.Priority.Max)
+	}
+	o.CreatedAt.build("created_at", add)
+	o.UpdatedAt.build("updated_at", add)
+	o.NotBefore.build("not_before", add)
+	if o.ReadyOnly {
+		add("not_before <= %s", now)
+	} else if o.DelayedOnly {
+		add("not_before > %s", now)
+	}
+	if o.IDs != nil {
+		ids := make([]string, 0, len(o.IDs))
+		for _, id := range o.IDs {
+			ids = append(ids, id.String())
+		}
+		add("id = ANY(%s::UUID[])", ids)
+	}
+	if o.IDPrefix != "" {
+		add("id::TEXT LIKE %s", o.IDPrefix+"%")
+	}
+	if len(o.PayloadContains) != 0 {
+		add("payload @> %s::JSONB", unsafeString(o.PayloadContains))
+	}
+	if o.Cursor != nil {
+		add("(priority < %[1]s OR (priority = %[1]s AND (updated_at > %[2]s OR (updated_at = %[2]s AND id > %[3]s))))", o.Cursor.Priority, o.Cursor.UpdatedAt, o.Cursor.ID)
+	}
+
+	return fmt.Sprintf(query, strings.Join(conds, " AND ")), args
+}
+
+type priorityRange struct {
+	Min, Max int16
+}
+
+// timeRange is a half-open [Min, Max) time range. Zero bounds are ignored.
+type timeRange struct {
+	Min, Max time.Time
+}
+
+func (r timeRange) validate() error {
+	if !r.Min.IsZero() && !r.Max.IsZero() && r.Max.Before(r.Min) {
+		return fmt.Errorf("time range %v..%v is invalid", r.Min, r.Max)
+	}
+	return nil
+}
+
+func (r timeRange) build(column string, add func(string, ...interface{})) {
+	if !r.Min.IsZero() {
+		add(column+" >= %s", r.Min)
+	}
+	if !r.Max.IsZero() {
+		add(column+" < %s", r.Max)
+	}
+}
+
 // ListOption can be applied when listing tasks.
 type ListOption interface {
 	applyListOption(*listOptions)
@@ -61,10 +192,84 @@ func WithLimit(v int64) ListOption {
 	return listOptionFunc(func(o *listOptions) { o.Limit = v })
 }
 
+// WithPriorityBetween restricts the list to tasks with a priority between min
+// and max (inclusive).
+func WithPriorityBetween(min, max int16) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.Priority = &priorityRange{Min: min, Max: max} })
+}
+
+// WithCreatedBetween restricts the list to tasks created at or after min and
+// before max. Zero values are treated as unbounded.
+func WithCreatedBetween(min, max time.Time) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.CreatedAt = timeRange{Min: min, Max: max} })
+}
+
+// WithUpdatedBetween restricts the list to tasks updated at or after min and
+// before max. Zero values are treated as unbounded.
+func WithUpdatedBetween(min, max time.Time) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.UpdatedAt = timeRange{Min: min, Max: max} })
+}
+
+// WithNotBeforeBetween restricts the list to tasks with a NotBefore at or
+// after min and before max. Zero values are treated as unbounded.
+func WithNotBeforeBetween(min, max time.Time) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.NotBefore = timeRange{Min: min, Max: max} })
+}
+
+// WithReadyOnly restricts the list to non-delayed tasks.
+func WithReadyOnly() ListOption {
+	return listOptionFunc(func(o *listOptions) { o.ReadyOnly = true })
+}
+
+// WithDelayedOnly restricts the list to delayed tasks.
+func WithDelayedOnly() ListOption {
+	return listOptionFunc(func(o *listOptions) { o.DelayedOnly = true })
+}
+
+// WithIDs restricts the list to tasks with the given IDs. An empty set of IDs
+// matches no tasks.
+func WithIDs(ids ...uuid.UUID) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.IDs = append([]uuid.UUID{}, ids...) })
+}
+
+// WithIDPrefix restricts the list to tasks with IDs starting with prefix, e.g.
+// "28667ce4".
+func WithIDPrefix(prefix string) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.IDPrefix = prefix })
+}
+
+// WithCursor continues a list after the task the cursor was obtained from (see
+// TaskDetails.Cursor). Unlike WithOffset, cursors are stable while tasks are
+// pushed or removed.
+func WithCursor(c string) ListOption {
+	cur, err := parseCursor(c)
+	return listOptionFunc(func(o *listOptions) { o.Cursor, o.cursorErr = cur, err })
+}
+
+// WithPayloadContains restricts the list to tasks with a payload that contains
+// the given JSON document (using the JSONB @> operator).
+func WithPayloadContains(doc json.RawMessage) ListOption {
+	return listOptionFunc(func(o *listOptions) { o.PayloadContains = doc })
+}
+
 // ----------------------------------------------------------------------------
 
 type scopeOptions struct {
-	Namespace namespace
+	Namespace    namespace
+	Namespaces   []namespace
+	Weights      []int
+	Ordered      bool
+	Lease        time.Duration
+	PollInterval time.Duration
+	Archive      bool
+	WorkerID     string
+}
+
+func (o *scopeOptions) getPollInterval() time.Duration {
+	if o.PollInterval == 0 {
+		return time.Second
+	}
+	return o.PollInterval
 }
 
 func (o *scopeOptions) set(opts ...ScopeOption) {
@@ -74,14 +279,222 @@ func (o *scopeOptions) set(opts ...ScopeOption) {
 }
 
 func (o *scopeOptions) validate() error {
+	if len(o.Namespaces) != 0 || o.Weights != nil {
+		return fmt.Errorf("multiple namespaces are only supported by Shift and WaitShift")
+	}
+	return o.validateShift()
+}
+
+// validateShift is like validate but also accepts multiple namespaces.
+func (o *scopeOptions) validateShift() error {
+	if o.Lease < 0 {
+		return fmt.Errorf("lease %v must not be negative", o.Lease)
+	}
+	if o.PollInterval < 0 {
+		return fmt.Errorf("poll interval %v must not be negative", o.PollInterval)
+	}
+	if o.Weights != nil && len(o.Namespaces) == 0 {
+		return fmt.Errorf("weighted namespaces must not be empty")
+	}
+	for i, ns := range o.Namespaces {
+		if err := ns.validate(); err != nil {
+			return err
+		}
+		if o.Weights != nil && o.Weights[i] < 1 {
+			return fmt.Errorf("weight %d of namespace %q must be positive", o.Weights[i], ns)
+		}
+	}
 	return o.Namespace.validate()
 }
 
+// getNamespaces returns the distinct namespaces in scope.
+func (o *scopeOptions) getNamespaces() []string {
+	if len(o.Namespaces) == 0 {
+		return []string{string(o.Namespace)}
+	}
+	return distinct(o.namespaces())
+}
+
+// namespaces returns the namespaces in scope, as given.
+func (o *scopeOptions) namespaces() []string {
+	names := make([]string, 0, len(o.Namespaces))
+	for _, ns := range o.Namespaces {
+		names = append(names, string(ns))
+	}
+	return names
+}
+
+// shiftOrder returns the groups of namespaces to shift from, in order.
+func (o *scopeOptions) shiftOrder() [][]string {
+	names := o.getNamespaces()
+	if o.Weights != nil {
+		names = distinct(weightedShuffle(o.namespaces(), o.Weights, rand.Intn))
+	} else if !o.Ordered {
+		return [][]string{names}
+	}
+
+	groups := make([][]string, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, []string{name})
+	}
+	return groups
+}
+
+// weightedShuffle returns names in random order, where the probability of a
+// name to come first is proportional to its weight.
+func weightedShuffle(names []string, weights []int, intn func(int) int) []string {
+	names = append([]string(nil), names...)
+	weights = append([]int(nil), weights...)
+
+	for i := range names {
+		var total int
+		for _, w := range weights[i:] {
+			total += w
+		}
+
+		n := intn(total)
+		for j := i; j < len(names); j++ {
+			if n -= weights[j]; n < 0 {
+				names[i], names[j] = names[j], names[i]
+				weights[i], weights[j] = weights[j], weights[i]
+				break
+			}
+		}
+	}
+	return names
+}
+
+// distinct returns names without duplicates, in order of first occurrence.
+func distinct(names []string) []string {
+	seen := make(map[string]struct{}, len(names))
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
 // ScopeOption can be applied when scoping results.
 type ScopeOption interface {
 	applyScopeOption(*scopeOptions)
 }
 
+type scopeOptionFunc func(*scopeOptions)
+
+func (f scopeOptionFunc) applyScopeOption(o *scopeOptions) { f(o) }
+
+// WithLease enables lease-based claims. Instead of holding a transaction open
+// until the claim is released, Shift and Claim lock the task for the given
+// duration and return immediately. Once the lease expires, the task becomes
+// visible to Shift again. Default: 0 (transaction-based claims).
+func WithLease(d time.Duration) ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) { o.Lease = d })
+}
+
+// WithPollInterval sets the interval at which WaitShift polls for tasks in
+// absence of notifications, e.g. to pick up delayed tasks or expired leases.
+// Default: 1s.
+func WithPollInterval(d time.Duration) ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) { o.PollInterval = d })
+}
+
+// WithArchive enables archiving of claimed tasks. Instead of deleting them,
+// Done moves tasks into the archive (see Client.ListArchive).
+func WithArchive() ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) { o.Archive = true })
+}
+
+// WithWorkerID sets the worker ID that is recorded with archived tasks.
+func WithWorkerID(id string) ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) { o.WorkerID = id })
+}
+
+// WithNamespaces allows Shift and WaitShift to claim tasks from multiple
+// namespaces. The task with the highest priority across all namespaces is
+// claimed first. Other methods reject multiple namespaces.
+func WithNamespaces(names ...string) ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) {
+		o.Namespaces, o.Weights, o.Ordered = toNamespaces(names), nil, false
+	})
+}
+
+// WithWeightedNamespaces allows Shift and WaitShift to claim tasks from
+// multiple namespaces with weighted-fair selection. Each namespace is
+// preferred with a probability proportional to its weight, regardless of task
+// priorities, so namespaces with a low weight are never starved. Weights must
+// be positive. Other methods reject multiple namespaces.
+func WithWeightedNamespaces(weights map[string]int) ScopeOption {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ws := make([]int, 0, len(names))
+	for _, name := range names {
+		ws = append(ws, weights[name])
+	}
+	return scopeOptionFunc(func(o *scopeOptions) {
+		o.Namespaces, o.Weights, o.Ordered = toNamespaces(names), ws, false
+	})
+}
+
+// WithPrioritizedNamespaces allows Shift and WaitShift to claim tasks from
+// multiple namespaces in strict order. Tasks are only claimed from a namespace
+// if all preceding namespaces are empty. Other methods reject multiple
+// namespaces.
+func WithPrioritizedNamespaces(names ...string) ScopeOption {
+	return scopeOptionFunc(func(o *scopeOptions) {
+		o.Namespaces, o.Weights, o.Ordered = toNamespaces(names), nil, true
+	})
+}
+
+// ----------------------------------------------------------------------------
+
+// ConflictMode determines how tasks with a UniqueKey that is already taken are
+// handled on push.
+type ConflictMode uint8
+
+const (
+	// ConflictError rejects the task with ErrDuplicateKey.
+	ConflictError ConflictMode = iota
+	// ConflictIgnore discards the task and sets its ID to the ID of the
+	// existing task.
+	ConflictIgnore
+	// ConflictReplace replaces the payload and priority of the existing task
+	// and sets the ID of the task accordingly. Keys reserved by completed
+	// tasks (see Task.UniqueFor) are treated like ConflictIgnore.
+	ConflictReplace
+)
+
+type pushOptions struct {
+	Conflict ConflictMode
+}
+
+func (o *pushOptions) set(opts ...PushOption) {
+	for _, opt := range opts {
+		opt.applyPushOption(o)
+	}
+}
+
+// PushOption can be applied when pushing tasks.
+type PushOption interface {
+	applyPushOption(*pushOptions)
+}
+
+type pushOptionFunc func(*pushOptions)
+
+func (f pushOptionFunc) applyPushOption(o *pushOptions) { f(o) }
+
+// WithConflictMode determines how to handle tasks with a UniqueKey that is
+// already taken. Default: ConflictError.
+func WithConflictMode(m ConflictMode) PushOption {
+	return pushOptionFunc(func(o *pushOptions) { o.Conflict = m })
+}
+
 // ----------------------------------------------------------------------------
 
 type namespace string
@@ -95,8 +508,14 @@ func (ns namespace) validate() error {
 	return nil
 }
 
+// channelOf returns the name of a notification channel.
+func channelOf(name string) string {
+	sum := md5.Sum([]byte(name))
+	return "pgpq_" + hex.EncodeToString(sum[:])
+}
+
 func (ns namespace) applyListOption(o *listOptions)   { o.Namespace = ns }
-func (ns namespace) applyScopeOption(o *scopeOptions) { o.Namespace = ns }
+func (ns namespace) applyScopeOption(o *scopeOptions) { o.Namespace, o.Namespaces = ns, nil }
 
 // NamespaceOption can be used in different methods.
 type NamespaceOption interface {
@@ -110,6 +529,53 @@ func WithNamespace(ns string) NamespaceOption {
 	return namespace(ns)
 }
 
+func toNamespaces(names []string) []namespace {
+	nss := make([]namespace, 0, len(names))
+	for _, name := range names {
+		nss = append(nss, namespace(name))
+	}
+	return nss
+}
+
+// ----------------------------------------------------------------------------
+
+// TaskChanges contains changes to apply to multiple tasks (see
+// Client.UpdateWhere). Nil fields are left unchanged, at least one field must
+// be set.
+type TaskChanges struct {
+	Namespace *string
+	Priority  *int16
+	// NotBefore moves the tasks to a new time, a zero time makes them
+	// available immediately.
+	NotBefore *time.Time
+}
+
+func (tc *TaskChanges) validate() error {
+	if tc.Namespace == nil && tc.Priority == nil && tc.NotBefore == nil {
+		return fmt.Errorf("task changes must not be empty")
+	}
+	if tc.Namespace != nil {
+		return namespace(*tc.Namespace).validate()
+	}
+	return nil
+}
+
+func (tc *TaskChanges) args() []interface{} {
+	var ns sql.NullString
+	if tc.Namespace != nil {
+		ns = sql.NullString{String: *tc.Namespace, Valid: true}
+	}
+	var prio sql.NullInt32
+	if tc.Priority != nil {
+		prio = sql.NullInt32{Int32: int32(*tc.Priority), Valid: true}
+	}
+	var notBefore sql.NullTime
+	if tc.NotBefore != nil {
+		notBefore = sql.NullTime{Time: coalesceTime(*tc.NotBefore, unixZero), Valid: true}
+	}
+	return []interface{}{ns, prio, notBefore}
+}
+
 // ----------------------------------------------------------------------------
 
 // Task contains the task definition.
@@ -119,33 +585,170 @@ type Task struct {
 	Priority  int16
 	Payload   json.RawMessage
 	NotBefore time.Time
+
+	// MaxAttempts limits the number of times a task can be shifted. Tasks
+	// that have exhausted their attempts and are no longer claimed, e.g.
+	// because a lease expired, are moved to the dead tasks by the next Shift.
+	// Transaction-based claims roll back the attempt if the connection is
+	// lost before the claim is released, so a task that crashes the worker is
+	// only counted with lease-based claims (see WithLease). Default: 0
+	// (unlimited).
+	MaxAttempts int32
+
+	// UniqueKey deduplicates tasks within a namespace. Only a single pending
+	// task may hold a given key at a time. Default: "" (no deduplication).
+	UniqueKey string
+	// UniqueFor keeps the UniqueKey reserved for the given duration after the
+	// task is done. Expired reservations are removed by
+	// Client.PurgeUniqueKeys. Default: 0 (released immediately).
+	UniqueFor time.Duration
+
+	// DependsOn contains the IDs of parent tasks. The task is not shifted
+	// until all of its parents are done. Parents which do not exist are
+	// considered done.
+	DependsOn []uuid.UUID
+	// CancelOnParentFailure buries the task when one of its parents is
+	// buried. Otherwise, the task remains blocked until the parent is
+	// requeued and done (or purged). Default: false.
+	CancelOnParentFailure bool
 }
 
 func (t *Task) validate() error {
+	if t.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts %d must not be negative", t.MaxAttempts)
+	}
+	if t.UniqueFor < 0 {
+		return fmt.Errorf("unique for %v must not be negative", t.UniqueFor)
+	}
 	return namespace(t.Namespace).validate()
 }
 
+// uniqueKey returns the unique key as a nullable value.
+func (t *Task) uniqueKey() sql.NullString {
+	return sql.NullString{String: t.UniqueKey, Valid: t.UniqueKey != ""}
+}
+
+// dependsOn returns the parent IDs as strings.
+func (t *Task) dependsOn() []string {
+	ids := make([]string, 0, len(t.DependsOn))
+	for _, id := range t.DependsOn {
+		ids = append(ids, id.String())
+	}
+	return ids
+}
+
+// uniqueFor returns UniqueFor in microseconds.
+func (t *Task) uniqueFor() int64 {
+	return t.UniqueFor.Microseconds()
+}
+
+// TaskStatus describes the state of a task.
+type TaskStatus string
+
+// Task statuses.
+const (
+	StatusPending   TaskStatus = "pending"
+	StatusCompleted TaskStatus = "completed"
+	StatusDead      TaskStatus = "dead"
+)
+
 // TaskDetails contains detailed task information.
 type TaskDetails struct {
 	Task
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Status      TaskStatus
+	Attempts    int32
+	LockedUntil time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// Result is only set for completed tasks, see Claim.DoneWithResult.
+	// FinishedAt is set for completed and buried tasks.
+	Result     json.RawMessage
+	FinishedAt time.Time
+}
+
+// Cursor returns an opaque cursor which can be passed to WithCursor in order
+// to continue a list after this task.
+func (td *TaskDetails) Cursor() string {
+	return (&cursor{Priority: td.Priority, UpdatedAt: td.UpdatedAt, ID: td.ID}).String()
 }
 
-func (td *TaskDetails) scan(rows interface{ Scan(...interface{}) error }) error {
-	return rows.Scan(
+func (td *TaskDetails) scan(rows rowScanner) error {
+	var uniqueKey sql.NullString
+	var uniqueFor int64
+	if err := rows.Scan(
 		&td.ID,
 		&td.Namespace,
 		&td.Priority,
 		&td.Payload,
 		&td.NotBefore,
+		&td.MaxAttempts,
+		&uniqueKey,
+		&uniqueFor,
+		&td.Attempts,
+		&td.LockedUntil,
 		&td.CreatedAt,
 		&td.UpdatedAt,
-	)
+	); err != nil {
+		return err
+	}
+	td.UniqueKey = uniqueKey.String
+	td.UniqueFor = time.Duration(uniqueFor) * time.Microsecond
+	td.Status = StatusPending
+	return nil
 }
 
 // ----------------------------------------------------------------------------
 
+// cursor is a position in a list ordered by priority DESC, updated_at ASC,
+// id ASC.
+type cursor struct {
+	Priority  int16
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func parseCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+
+	parts := strings.SplitN(string(b), ",", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+
+	priority, err := strconv.ParseInt(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	return &cursor{Priority: int16(priority), UpdatedAt: updatedAt, ID: id}, nil
+}
+
+func (c *cursor) String() string {
+	s := strconv.FormatInt(int64(c.Priority), 10) + "," + c.UpdatedAt.UTC().Format(time.RFC3339Nano) + "," + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// ----------------------------------------------------------------------------
+
+type rowScanner interface {
+	Scan(...interface{}) error
+}
+
+type queryRowFunc func(ctx context.Context, query string, args ...interface{}) rowScanner
+
+// ----------------------------------------------------------------------------
+
 var unixZero = time.Unix(0, 0).UTC()
 
 func coalesceTime(t1, t2 time.Time) time.Time {
@@ -155,6 +758,16 @@ func coalesceTime(t1, t2 time.Time) time.Time {
 	return t2
 }
 
+func isDuplicateID(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "pgpq_tasks_pkey"
+}
+
+func isDuplicateKey(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_pgpq_tasks_unique_key"
+}
+
 func unsafeString(p []byte) string {
 	return unsafe.String(unsafe.SliceData(p), len(p))
 }
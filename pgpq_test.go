@@ -17,17 +17,19 @@ var (
 	mockNow  = time.Now().UTC().Truncate(24 * time.Hour)
 )
 
-var client *Client
+var (
+	client *Client
+	dbURL  = "postgres://localhost/pgpq_test?sslmode=disable"
+)
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
-	url := "postgres://localhost/pgpq_test?sslmode=disable"
 	if v := os.Getenv("DATABASE_URL"); v != "" {
-		url = v
+		dbURL = v
 	}
 
 	var err error
-	client, err = Connect(ctx, url)
+	client, err = Connect(ctx, dbURL)
 	if err != nil {
 		panic(err)
 	}
@@ -45,7 +47,7 @@ func Test_schemaVersion(t *testing.T) {
 	version, err := client.SchemaVersion(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
-	} else if exp, got := "4", version; exp != got {
+	} else if exp, got := "19", version; exp != got {
 		t.Errorf("expected %v, got %v", exp, got)
 	}
 }
@@ -0,0 +1,82 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Await blocks until the task with the given ID is completed and returns its
+// result (see Claim.DoneWithResult). It listens for notifications and falls
+// back to polling (see WithPollInterval). Only the poll interval option is
+// applied. It returns ErrBuried if the task was buried and ErrNoTask if the
+// task does not exist or was completed without a result.
+func (c *Client) Await(ctx context.Context, id uuid.UUID, opts ...ScopeOption) (json.RawMessage, error) {
+	opt := &scopeOptions{PollInterval: c.opt.PollInterval}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+
+	var result json.RawMessage
+	err := c.wait(ctx, []string{channelOf(id.String())}, opt.getPollInterval(), func() (bool, error) {
+		td, err := c.Get(ctx, id)
+		if err != nil {
+			return false, err
+		}
+
+		switch td.Status {
+		case StatusCompleted:
+			result = td.Result
+			return true, nil
+		case StatusDead:
+			return false, ErrBuried
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PurgeResults permanently deletes the results of tasks which completed more
+// than olderThan ago. It returns the number of deleted results.
+func (c *Client) PurgeResults(ctx context.Context, olderThan time.Duration, opts ...ScopeOption) (int64, error) {
+	opt := &scopeOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return 0, err
+	}
+
+	res, err := c.db.ExecContext(ctx, `DELETE FROM pgpq_task_results WHERE namespace = $1 AND finished_at < $2`, opt.Namespace, c.clock.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (c *Client) getResult(ctx context.Context, id uuid.UUID) (*TaskDetails, error) {
+	td := &TaskDetails{Status: StatusCompleted}
+	if err := c.db.QueryRowContext(ctx, stmtGetResult, id).Scan(
+		&td.ID,
+		&td.Namespace,
+		&td.Priority,
+		&td.Payload,
+		&td.Attempts,
+		&td.Result,
+		&td.CreatedAt,
+		&td.FinishedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTask
+		}
+		return nil, err
+	}
+	td.UpdatedAt = td.FinishedAt
+	return td, nil
+}
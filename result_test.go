@@ -0,0 +1,114 @@
+package pgpq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+	"github.com/google/uuid"
+)
+
+func TestClaim_DoneWithResult(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	claim, err := client.Claim(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.DoneWithResult(ctx, json.RawMessage(`{"ok":true}`)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	td, err := client.Get(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := StatusCompleted, td.Status; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := `{"ok": true}`, string(td.Result); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := mockNow, td.FinishedAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := int32(1), td.Attempts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// removed from the queue
+	if tasks, err := client.List(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(tasks); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestClient_Await(t *testing.T) {
+	ctx := context.Background()
+	task1, task2, _ := seedTriple(ctx, t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		claim, err := client.Claim(ctx, task1.ID, WithLease(time.Minute))
+		if err != nil {
+			return
+		}
+		_ = claim.DoneWithResult(ctx, json.RawMessage(`[1,2]`))
+	}()
+
+	if result, err := client.Await(ctx, task1.ID, WithPollInterval(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := `[1, 2]`, string(result); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// buried
+	claim, err := client.Claim(ctx, task2.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.Bury(ctx, "boom"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Await(ctx, task2.ID); !errors.Is(err, ErrBuried) {
+		t.Errorf("expected %v, got %v", ErrBuried, err)
+	}
+
+	// unknown
+	if _, err := client.Await(ctx, uuid.New()); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
+
+func TestClient_PurgeResults(t *testing.T) {
+	ctx := context.Background()
+	task1, _, _ := seedTriple(ctx, t)
+
+	claim, err := client.Claim(ctx, task1.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := claim.DoneWithResult(ctx, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n, err := client.PurgeResults(ctx, time.Hour); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	timeTravel(mockNow.Add(2*time.Hour), func() {
+		if n, err := client.PurgeResults(ctx, time.Hour); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if exp, got := int64(1), n; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+
+	if _, err := client.Get(ctx, task1.ID); !errors.Is(err, ErrNoTask) {
+		t.Errorf("expected %v, got %v", ErrNoTask, err)
+	}
+}
@@ -0,0 +1,277 @@
+package pgpq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleSpace is the namespace for deterministic occurrence IDs.
+var scheduleSpace = uuid.MustParse("5d0f5d43-5c55-4b7e-8f39-3c6a0b7e2f11")
+
+// Schedule contains information about a recurring task.
+type Schedule struct {
+	// Name uniquely identifies the schedule.
+	Name string
+	// Spec is a standard cron expression (e.g. "*/5 * * * *") or a
+	// descriptor (e.g. "@hourly", "@every 10m"). Times are in UTC unless
+	// prefixed with CRON_TZ=.
+	Spec string
+	// Task is the template for each occurrence. ID, NotBefore, UniqueKey,
+	// UniqueFor and DependsOn are ignored.
+	Task Task
+
+	Paused    bool
+	NextAt    time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (s *Schedule) scan(rows rowScanner) error {
+	return rows.Scan(
+		&s.Name,
+		&s.Spec,
+		&s.Task.Namespace,
+		&s.Task.Priority,
+		&s.Task.Payload,
+		&s.Task.MaxAttempts,
+		&s.Paused,
+		&s.NextAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+}
+
+// occurrenceID returns the deterministic ID of the occurrence at t.
+func occurrenceID(name string, t time.Time) uuid.UUID {
+	return uuid.NewSHA1(scheduleSpace, []byte(name+"@"+t.UTC().Format(time.RFC3339Nano)))
+}
+
+// Schedule creates or updates a recurring task. The next occurrence is pushed
+// into the queue as a delayed task immediately, subsequent occurrences are
+// pushed by RunSchedules. Occurrences have deterministic IDs, they are pushed
+// exactly once, even if RunSchedules is called concurrently by multiple
+// instances.
+func (c *Client) Schedule(ctx context.Context, name, spec string, task *Task) error {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule spec %q: %w", spec, err)
+	}
+
+	tpl := *task
+	if err := c.normTask(&tpl); err != nil {
+		return err
+	}
+
+	now := c.clock.Now()
+	nextAt := sched.Next(now.UTC())
+
+	return c.scheduleTx(ctx, name, func(tx *sql.Tx, prev *Schedule) error {
+		if prev != nil && !prev.Paused {
+			if err := c.unscheduleNext(ctx, tx, prev); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, stmtUpsertSchedule, name, spec, tpl.Namespace, tpl.Priority, unsafeString(tpl.Payload), tpl.MaxAttempts, nextAt, now); err != nil {
+			return err
+		}
+		if prev != nil && prev.Paused {
+			return nil
+		}
+		return c.scheduleNext(ctx, tx, name, &tpl, nextAt, now)
+	})
+}
+
+// GetSchedule returns a schedule by name. It may return ErrNoSchedule.
+func (c *Client) GetSchedule(ctx context.Context, name string) (*Schedule, error) {
+	s := new(Schedule)
+	if err := s.scan(c.db.QueryRowContext(ctx, stmtGetSchedule, name)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSchedule
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListSchedules lists all schedules. Only namespace, limit and offset options
+// are applied.
+func (c *Client) ListSchedules(ctx context.Context, opts ...ListOption) ([]*Schedule, error) {
+	opt := &listOptions{Namespace: c.opt.Namespace}
+	opt.set(opts...)
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	limit := opt.getLimit()
+
+	rows, err := c.db.QueryContext(ctx, stmtListSchedules, opt.Namespace, limit, opt.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]*Schedule, 0, limit)
+	for rows.Next() {
+		s := new(Schedule)
+		if err := s.scan(rows); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// PauseSchedule pauses a schedule and removes its upcoming occurrence from the
+// queue. It may return ErrNoSchedule.
+func (c *Client) PauseSchedule(ctx context.Context, name string) error {
+	return c.scheduleTx(ctx, name, func(tx *sql.Tx, prev *Schedule) error {
+		if prev == nil {
+			return ErrNoSchedule
+		} else if prev.Paused {
+			return nil
+		}
+
+		if err := c.unscheduleNext(ctx, tx, prev); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE pgpq_schedules SET paused = TRUE, updated_at = $2 WHERE name = $1`, name, c.clock.Now())
+		return err
+	})
+}
+
+// ResumeSchedule resumes a paused schedule and pushes its next occurrence. It
+// may return ErrNoSchedule.
+func (c *Client) ResumeSchedule(ctx context.Context, name string) error {
+	return c.scheduleTx(ctx, name, func(tx *sql.Tx, prev *Schedule) error {
+		if prev == nil {
+			return ErrNoSchedule
+		} else if !prev.Paused {
+			return nil
+		}
+
+		sched, err := cron.ParseStandard(prev.Spec)
+		if err != nil {
+			return err
+		}
+
+		now := c.clock.Now()
+		nextAt := sched.Next(now.UTC())
+		if _, err := tx.ExecContext(ctx, `UPDATE pgpq_schedules SET paused = FALSE, next_at = $2, updated_at = $3 WHERE name = $1`, name, nextAt, now); err != nil {
+			return err
+		}
+		return c.scheduleNext(ctx, tx, name, &prev.Task, nextAt, now)
+	})
+}
+
+// DeleteSchedule deletes a schedule and removes its upcoming occurrence from
+// the queue. It may return ErrNoSchedule.
+func (c *Client) DeleteSchedule(ctx context.Context, name string) error {
+	return c.scheduleTx(ctx, name, func(tx *sql.Tx, prev *Schedule) error {
+		if prev == nil {
+			return ErrNoSchedule
+		} else if !prev.Paused {
+			if err := c.unscheduleNext(ctx, tx, prev); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM pgpq_schedules WHERE name = $1`, name)
+		return err
+	})
+}
+
+// RunSchedules pushes the following occurrence of all schedules with a due
+// occurrence. Missed occurrences are skipped. It should be called
+// periodically, e.g. every minute, and is safe to call concurrently from
+// multiple instances. It returns the number of pushed occurrences.
+func (c *Client) RunSchedules(ctx context.Context) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := c.clock.Now()
+	rows, err := tx.QueryContext(ctx, stmtDueSchedules, now)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var due []*Schedule
+	for rows.Next() {
+		s := new(Schedule)
+		if err := s.scan(rows); err != nil {
+			return 0, err
+		}
+		due = append(due, s)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	_ = rows.Close()
+
+	for _, s := range due {
+		sched, err := cron.ParseStandard(s.Spec)
+		if err != nil {
+			return 0, err
+		}
+
+		nextAt := sched.Next(now.UTC())
+		if _, err := tx.ExecContext(ctx, `UPDATE pgpq_schedules SET next_at = $2 WHERE name = $1`, s.Name, nextAt); err != nil {
+			return 0, err
+		}
+		if err := c.scheduleNext(ctx, tx, s.Name, &s.Task, nextAt, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// scheduleTx runs fn within a transaction, passing the locked schedule (or
+// nil if it does not exist).
+func (c *Client) scheduleTx(ctx context.Context, name string, fn func(*sql.Tx, *Schedule) error) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	prev := new(Schedule)
+	if err := prev.scan(tx.QueryRowContext(ctx, stmtGetSchedule+` FOR UPDATE`, name)); errors.Is(err, sql.ErrNoRows) {
+		prev = nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := fn(tx, prev); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scheduleNext pushes the occurrence at nextAt.
+func (c *Client) scheduleNext(ctx context.Context, tx *sql.Tx, name string, task *Task, nextAt, now time.Time) error {
+	_, err := tx.ExecContext(ctx, stmtPushOccurrence, occurrenceID(name, nextAt), task.Namespace, task.Priority, unsafeString(task.Payload), nextAt, task.MaxAttempts, now)
+	return err
+}
+
+// unscheduleNext removes the upcoming occurrence, unless it is already due.
+func (c *Client) unscheduleNext(ctx context.Context, tx *sql.Tx, s *Schedule) error {
+	_, err := tx.ExecContext(ctx, stmtDeleteOccurrence, occurrenceID(s.Name, s.NextAt), c.clock.Now())
+	return err
+}
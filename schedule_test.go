@@ -0,0 +1,136 @@
+package pgpq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/bsm/pgpq"
+)
+
+func TestClient_Schedule(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	assertLen := func(exp int) {
+		t.Helper()
+
+		if tasks, err := client.List(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if got := len(tasks); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	}
+
+	if err := client.Schedule(ctx, "hourly", "not a spec", &Task{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	task := &Task{Priority: 2, Payload: json.RawMessage(`{"cron":true}`)}
+	if err := client.Schedule(ctx, "hourly", "@hourly", task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertLen(1)
+
+	// idempotent
+	if err := client.Schedule(ctx, "hourly", "@hourly", task); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertLen(1)
+
+	sched, err := client.GetSchedule(ctx, "hourly")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := mockNow.Add(time.Hour), sched.NextAt; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	} else if exp, got := int16(2), sched.Task.Priority; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if tasks, err := client.List(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := mockNow.Add(time.Hour), tasks[0].NotBefore; !exp.Equal(got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// nothing due yet
+	if n, err := client.RunSchedules(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 0, n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	timeTravel(mockNow.Add(90*time.Minute), func() {
+		// next occurrence is pushed exactly once
+		for i, exp := range []int{1, 0} {
+			if n, err := client.RunSchedules(ctx); err != nil {
+				t.Fatalf("[%d] expected no error, got %v", i, err)
+			} else if got := n; exp != got {
+				t.Errorf("[%d] expected %v, got %v", i, exp, got)
+			}
+		}
+		assertLen(2)
+
+		// pause removes the upcoming occurrence
+		if err := client.PauseSchedule(ctx, "hourly"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertLen(1)
+
+		if sched, err := client.GetSchedule(ctx, "hourly"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if !sched.Paused {
+			t.Error("expected schedule to be paused")
+		}
+
+		// resume pushes it again
+		if err := client.ResumeSchedule(ctx, "hourly"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertLen(2)
+
+		// delete removes the upcoming occurrence
+		if err := client.DeleteSchedule(ctx, "hourly"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertLen(1)
+	})
+
+	if _, err := client.GetSchedule(ctx, "hourly"); !errors.Is(err, ErrNoSchedule) {
+		t.Errorf("expected %v, got %v", ErrNoSchedule, err)
+	}
+	if err := client.PauseSchedule(ctx, "hourly"); !errors.Is(err, ErrNoSchedule) {
+		t.Errorf("expected %v, got %v", ErrNoSchedule, err)
+	}
+}
+
+func TestClient_ListSchedules(t *testing.T) {
+	ctx := context.Background()
+	truncate(ctx, t)
+
+	for _, name := range []string{"b", "a"} {
+		if err := client.Schedule(ctx, name, "@daily", &Task{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := client.Schedule(ctx, "c", "@daily", &Task{Namespace: "baz"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	schedules, err := client.ListSchedules(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 2, len(schedules); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	} else if exp, got := "a", schedules[0].Name; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if schedules, err := client.ListSchedules(ctx, WithNamespace("baz")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(schedules); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
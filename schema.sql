@@ -19,7 +19,13 @@ CREATE TABLE IF NOT EXISTS pgpq_tasks (
   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   payload JSONB NOT NULL DEFAULT '{}',
-  not_before TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0)
+  not_before TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 0,
+  locked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0),
+  locked_by UUID,
+  unique_key TEXT COLLATE "C",
+  unique_for BIGINT NOT NULL DEFAULT 0
 );
 
 CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_namespace ON pgpq_tasks (namespace ASC);
@@ -32,6 +38,258 @@ ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS not_before TIMESTAMP WITH TIME Z
 
 CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_not_before ON pgpq_tasks (not_before ASC);
 
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0);
+
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS locked_by UUID;
+
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS unique_key TEXT COLLATE "C";
+
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS unique_for BIGINT NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pgpq_tasks_unique_key ON pgpq_tasks (namespace, unique_key) WHERE unique_key IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_exhausted ON pgpq_tasks (namespace ASC) WHERE max_attempts > 0 AND attempts >= max_attempts;
+
+--
+-- Notify listeners about new and updated tasks
+--
+CREATE OR REPLACE FUNCTION pgpq_notify() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('pgpq_' || md5(NEW.namespace), '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS pgpq_tasks_notify_insert ON pgpq_tasks;
+
+CREATE TRIGGER pgpq_tasks_notify_insert
+AFTER INSERT ON pgpq_tasks
+FOR EACH ROW EXECUTE PROCEDURE pgpq_notify();
+
+DROP TRIGGER IF EXISTS pgpq_tasks_notify_update ON pgpq_tasks;
+
+CREATE TRIGGER pgpq_tasks_notify_update
+AFTER UPDATE ON pgpq_tasks
+FOR EACH ROW
+WHEN (OLD.updated_at IS DISTINCT FROM NEW.updated_at OR OLD.locked_until > NEW.locked_until)
+EXECUTE PROCEDURE pgpq_notify();
+
+--
+-- Task dependencies table
+--
+CREATE TABLE IF NOT EXISTS pgpq_task_deps (
+  task_id UUID NOT NULL REFERENCES pgpq_tasks (id) ON DELETE CASCADE,
+  parent_id UUID NOT NULL,
+  cancel_on_failure BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (task_id, parent_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_task_deps_parent_id ON pgpq_task_deps (parent_id ASC);
+
+--
+-- Notify listeners about unblocked tasks
+--
+CREATE OR REPLACE FUNCTION pgpq_notify_unblocked() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('pgpq_' || md5(namespace), '') FROM pgpq_tasks WHERE id = OLD.task_id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS pgpq_task_deps_notify_delete ON pgpq_task_deps;
+
+CREATE TRIGGER pgpq_task_deps_notify_delete
+AFTER DELETE ON pgpq_task_deps
+FOR EACH ROW EXECUTE PROCEDURE pgpq_notify_unblocked();
+
+--
+-- Cancellations of claimed tasks
+--
+CREATE TABLE IF NOT EXISTS pgpq_cancellations (
+  task_id UUID PRIMARY KEY,
+  cancelled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+--
+-- Dead tasks table
+--
+CREATE TABLE IF NOT EXISTS pgpq_dead_tasks (
+  id UUID PRIMARY KEY,
+  namespace TEXT COLLATE "C" NOT NULL DEFAULT '',
+  priority SMALLINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  payload JSONB NOT NULL DEFAULT '{}',
+  not_before TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 0,
+  unique_key TEXT COLLATE "C",
+  unique_for BIGINT NOT NULL DEFAULT 0,
+  reason TEXT NOT NULL DEFAULT '',
+  failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE pgpq_dead_tasks ADD COLUMN IF NOT EXISTS unique_key TEXT COLLATE "C";
+
+ALTER TABLE pgpq_dead_tasks ADD COLUMN IF NOT EXISTS unique_for BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_dead_tasks_namespace ON pgpq_dead_tasks (namespace ASC);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_dead_tasks_failed_at ON pgpq_dead_tasks (failed_at ASC);
+
+--
+-- Unique keys of completed tasks, reserved until a deadline
+--
+CREATE TABLE IF NOT EXISTS pgpq_unique_keys (
+  namespace TEXT COLLATE "C" NOT NULL,
+  unique_key TEXT COLLATE "C" NOT NULL,
+  task_id UUID NOT NULL,
+  reserved_until TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (namespace, unique_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_unique_keys_reserved_until ON pgpq_unique_keys (reserved_until ASC);
+
+--
+-- Results of completed tasks
+--
+CREATE TABLE IF NOT EXISTS pgpq_task_results (
+  id UUID PRIMARY KEY,
+  namespace TEXT COLLATE "C" NOT NULL DEFAULT '',
+  priority SMALLINT NOT NULL DEFAULT 0,
+  payload JSONB NOT NULL DEFAULT '{}',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  result JSONB NOT NULL DEFAULT 'null',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_task_results_namespace ON pgpq_task_results (namespace ASC);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_task_results_finished_at ON pgpq_task_results (finished_at ASC);
+
+--
+-- Notify listeners about finished tasks
+--
+CREATE OR REPLACE FUNCTION pgpq_notify_finished() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('pgpq_' || md5(NEW.id::TEXT), '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS pgpq_task_results_notify ON pgpq_task_results;
+
+CREATE TRIGGER pgpq_task_results_notify
+AFTER INSERT OR UPDATE ON pgpq_task_results
+FOR EACH ROW EXECUTE PROCEDURE pgpq_notify_finished();
+
+DROP TRIGGER IF EXISTS pgpq_dead_tasks_notify ON pgpq_dead_tasks;
+
+CREATE TRIGGER pgpq_dead_tasks_notify
+AFTER INSERT OR UPDATE ON pgpq_dead_tasks
+FOR EACH ROW EXECUTE PROCEDURE pgpq_notify_finished();
+
+--
+-- Archive of completed tasks
+--
+CREATE TABLE IF NOT EXISTS pgpq_tasks_archive (
+  id UUID PRIMARY KEY,
+  namespace TEXT COLLATE "C" NOT NULL DEFAULT '',
+  priority SMALLINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  payload JSONB NOT NULL DEFAULT '{}',
+  not_before TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT TO_TIMESTAMP(0),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 0,
+  unique_key TEXT COLLATE "C",
+  unique_for BIGINT NOT NULL DEFAULT 0,
+  result JSONB,
+  worker_id TEXT NOT NULL DEFAULT '',
+  completed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_archive_namespace ON pgpq_tasks_archive (namespace ASC);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_archive_completed_at ON pgpq_tasks_archive (completed_at DESC);
+
+--
+-- Schedules table
+--
+CREATE TABLE IF NOT EXISTS pgpq_schedules (
+  name TEXT COLLATE "C" PRIMARY KEY,
+  spec TEXT NOT NULL,
+  namespace TEXT COLLATE "C" NOT NULL DEFAULT '',
+  priority SMALLINT NOT NULL DEFAULT 0,
+  payload JSONB NOT NULL DEFAULT '{}',
+  max_attempts INTEGER NOT NULL DEFAULT 0,
+  paused BOOLEAN NOT NULL DEFAULT FALSE,
+  next_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_schedules_namespace ON pgpq_schedules (namespace ASC);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_schedules_next_at ON pgpq_schedules (next_at ASC);
+
+--
+-- Namespace settings table
+--
+CREATE TABLE IF NOT EXISTS pgpq_namespaces (
+  namespace TEXT COLLATE "C" PRIMARY KEY,
+  aging_interval BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE pgpq_namespaces ADD COLUMN IF NOT EXISTS paused BOOLEAN NOT NULL DEFAULT FALSE;
+
+--
+-- Concurrency slots, limit the number of concurrently claimed tasks per
+-- namespace. Slots are either locked by a transaction-based claim or
+-- reference the lease of a lease-based claim.
+--
+CREATE TABLE IF NOT EXISTS pgpq_concurrency_slots (
+  namespace TEXT COLLATE "C" NOT NULL,
+  slot INTEGER NOT NULL,
+  lease UUID,
+  PRIMARY KEY (namespace, slot)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_locked_by ON pgpq_tasks (locked_by ASC) WHERE locked_by IS NOT NULL;
+
+--
+-- Priority aging, tasks of a namespace with aging enabled are shifted in order
+-- of aged_at, which is updated_at - priority * aging_interval
+--
+ALTER TABLE pgpq_tasks ADD COLUMN IF NOT EXISTS aged_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_pgpq_tasks_aged_at;
+
+CREATE INDEX IF NOT EXISTS idx_pgpq_tasks_aged_order ON pgpq_tasks (namespace ASC, aged_at ASC, priority DESC, updated_at ASC);
+
+CREATE OR REPLACE FUNCTION pgpq_set_aged_at() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.aged_at := (
+    SELECT NEW.updated_at - NEW.priority * aging_interval * INTERVAL '1 microsecond'
+    FROM pgpq_namespaces
+    WHERE namespace = NEW.namespace AND aging_interval > 0
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS pgpq_tasks_aged_at ON pgpq_tasks;
+
+CREATE TRIGGER pgpq_tasks_aged_at
+BEFORE INSERT OR UPDATE OF namespace, priority, updated_at ON pgpq_tasks
+FOR EACH ROW EXECUTE PROCEDURE pgpq_set_aged_at();
+
 --
 -- Meta info table
 --
@@ -44,7 +302,7 @@ CREATE TABLE IF NOT EXISTS pgpq_meta_info (
 INSERT INTO
   pgpq_meta_info
 VALUES
-  ('schema_version', '4') ON CONFLICT (name) DO
+  ('schema_version', '19') ON CONFLICT (name) DO
 UPDATE
 SET
   value = EXCLUDED.value;
@@ -2,17 +2,87 @@ package pgpq
 
 const (
 	stmtPush = `
-		INSERT INTO pgpq_tasks (namespace, priority, payload, not_before, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO pgpq_tasks (namespace, priority, payload, not_before, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id
 	`
 
 	stmtPushWithID = `
-		INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	stmtPushUnique = `
+		WITH reserved AS (
+			SELECT task_id
+			FROM pgpq_unique_keys
+			WHERE namespace = $2
+				AND unique_key = $7
+				AND reserved_until > $9
+		)
+		INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, updated_at)
+		SELECT $1::UUID, $2::TEXT, $3::SMALLINT, $4::JSONB, $5::TIMESTAMPTZ, $6::INTEGER, $7::TEXT, $8::BIGINT, $9::TIMESTAMPTZ, $9::TIMESTAMPTZ
+		WHERE NOT EXISTS (SELECT 1 FROM reserved)
 		RETURNING id
 	`
 
+	stmtPushUniqueIgnore = `
+		WITH reserved AS (
+			SELECT task_id
+			FROM pgpq_unique_keys
+			WHERE namespace = $2
+				AND unique_key = $7
+				AND reserved_until > $9
+		), inserted AS (
+			INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, updated_at)
+			SELECT $1::UUID, $2::TEXT, $3::SMALLINT, $4::JSONB, $5::TIMESTAMPTZ, $6::INTEGER, $7::TEXT, $8::BIGINT, $9::TIMESTAMPTZ, $9::TIMESTAMPTZ
+			WHERE NOT EXISTS (SELECT 1 FROM reserved)
+			ON CONFLICT (namespace, unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+			RETURNING id
+		)
+		SELECT id FROM inserted
+		UNION ALL
+		SELECT task_id FROM reserved
+		UNION ALL
+		SELECT id FROM pgpq_tasks WHERE namespace = $2 AND unique_key = $7
+		LIMIT 1
+	`
+
+	stmtPushUniqueReplace = `
+		WITH reserved AS (
+			SELECT task_id
+			FROM pgpq_unique_keys
+			WHERE namespace = $2
+				AND unique_key = $7
+				AND reserved_until > $9
+		), upserted AS (
+			INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, updated_at)
+			SELECT $1::UUID, $2::TEXT, $3::SMALLINT, $4::JSONB, $5::TIMESTAMPTZ, $6::INTEGER, $7::TEXT, $8::BIGINT, $9::TIMESTAMPTZ, $9::TIMESTAMPTZ
+			WHERE NOT EXISTS (SELECT 1 FROM reserved)
+			ON CONFLICT (namespace, unique_key) WHERE unique_key IS NOT NULL DO UPDATE
+			SET
+				priority = EXCLUDED.priority,
+				payload  = EXCLUDED.payload
+			RETURNING id
+		)
+		SELECT id FROM upserted
+		UNION ALL
+		SELECT task_id FROM reserved
+		LIMIT 1
+	`
+
+	stmtPushDeps = `
+		WITH inserted AS (
+			INSERT INTO pgpq_task_deps (task_id, parent_id, cancel_on_failure)
+			SELECT $1, parent_id, $3
+			FROM UNNEST($2::UUID[]) AS parent_id
+			ON CONFLICT DO NOTHING
+			RETURNING task_id
+		)
+		SELECT COUNT(*) FROM inserted
+	`
+
 	stmtGet = `
 		SELECT
 			id,
@@ -20,44 +90,398 @@ const (
 			priority,
 			payload,
 			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			locked_until,
 			created_at,
 			updated_at
 		FROM pgpq_tasks
 		WHERE id = $1
 	`
 
+	stmtGetResult = `
+		SELECT
+			id,
+			namespace,
+			priority,
+			payload,
+			attempts,
+			result,
+			created_at,
+			finished_at
+		FROM pgpq_task_results
+		WHERE id = $1
+	`
+
+	// shiftReady restricts shifts to tasks which are ready to be claimed.
+	shiftReady = `
+				AND not_before <= $2
+				AND locked_until <= $2
+				AND (max_attempts = 0 OR attempts < max_attempts)
+				AND NOT EXISTS (SELECT 1 FROM pgpq_cancellations c WHERE c.task_id = pgpq_tasks.id)
+				AND NOT EXISTS (
+					SELECT 1
+					FROM pgpq_task_deps d
+					WHERE d.task_id = pgpq_tasks.id
+						AND (
+							EXISTS (SELECT 1 FROM pgpq_tasks p WHERE p.id = d.parent_id)
+							OR EXISTS (SELECT 1 FROM pgpq_dead_tasks p WHERE p.id = d.parent_id)
+						)
+				)
+				AND NOT EXISTS (
+					SELECT 1
+					FROM pgpq_namespaces n
+					WHERE n.namespace = pgpq_tasks.namespace
+						AND n.paused
+				)`
+
+	// shiftSlotFree restricts shifts to namespaces which have not reached their
+	// concurrency limit.
+	shiftSlotFree = `
+				AND (
+					NOT EXISTS (SELECT 1 FROM pgpq_concurrency_slots s WHERE s.namespace = pgpq_tasks.namespace)
+					OR EXISTS (
+						SELECT 1
+						FROM pgpq_concurrency_slots s
+						WHERE s.namespace = pgpq_tasks.namespace
+							AND (s.lease IS NULL OR NOT EXISTS (SELECT 1 FROM pgpq_tasks l WHERE l.locked_by = s.lease AND l.locked_until > $2))
+					)
+				)`
+
+	// shiftEffectivePriority is the priority of a task, including aging.
+	shiftEffectivePriority = `
+				priority + COALESCE((
+					SELECT EXTRACT(EPOCH FROM $2::TIMESTAMPTZ - pgpq_tasks.updated_at) * 1000000 / n.aging_interval
+					FROM pgpq_namespaces n
+					WHERE n.namespace = pgpq_tasks.namespace
+						AND n.aging_interval > 0
+				), 0)`
+
+	// shiftNLimit limits batches to the available concurrency slots.
+	shiftNLimit = `
+			LIMIT CASE
+				WHEN EXISTS (SELECT 1 FROM pgpq_concurrency_slots WHERE namespace = $1) THEN (SELECT COUNT(*) FROM slots)
+				ELSE $3
+			END`
+
+	// shiftBuryExhausted moves exhausted tasks (selected by the preceding
+	// exhausted CTE) to the dead tasks, along with their descendants which
+	// depend on them with CancelOnParentFailure.
+	shiftBuryExhausted = `, exhausted_descendants AS (
+			SELECT d.task_id, d.parent_id AS root_id
+			FROM pgpq_task_deps d
+			JOIN exhausted ON exhausted.id = d.parent_id
+			WHERE d.cancel_on_failure
+			UNION
+			SELECT d.task_id, exhausted_descendants.root_id
+			FROM pgpq_task_deps d
+			JOIN exhausted_descendants ON exhausted_descendants.task_id = d.parent_id
+			WHERE d.cancel_on_failure
+		), exhausted_cancelled AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE id IN (SELECT task_id FROM exhausted_descendants)
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				attempts,
+				created_at,
+				updated_at
+		), exhausted_uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM exhausted_cancelled)
+		), exhausted_buried AS (
+			INSERT INTO pgpq_dead_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at, reason, failed_at)
+			SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at, 'max attempts exceeded', $2::TIMESTAMPTZ
+			FROM exhausted
+			UNION ALL
+			SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at,
+				'parent ' || (SELECT MIN(e.root_id::TEXT) FROM exhausted_descendants e WHERE e.task_id = exhausted_cancelled.id) || ' failed', $2::TIMESTAMPTZ
+			FROM exhausted_cancelled
+			ON CONFLICT (id) DO UPDATE
+			SET
+				namespace    = EXCLUDED.namespace,
+				priority     = EXCLUDED.priority,
+				payload      = EXCLUDED.payload,
+				not_before   = EXCLUDED.not_before,
+				max_attempts = EXCLUDED.max_attempts,
+				unique_key   = EXCLUDED.unique_key,
+				unique_for   = EXCLUDED.unique_for,
+				attempts     = EXCLUDED.attempts,
+				created_at   = EXCLUDED.created_at,
+				updated_at   = EXCLUDED.updated_at,
+				reason       = EXCLUDED.reason,
+				failed_at    = EXCLUDED.failed_at
+		)`
+
 	stmtShift = `
+		WITH RECURSIVE dropped AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT t.id
+				FROM pgpq_cancellations c
+				JOIN pgpq_tasks t ON t.id = c.task_id
+				WHERE t.namespace = ANY($1)
+					AND t.locked_until <= $2
+				FOR UPDATE OF t SKIP LOCKED
+			)
+			RETURNING id
+		), uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM dropped)
+		), exhausted AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE namespace = ANY($1)
+					AND max_attempts > 0
+					AND attempts >= max_attempts
+					AND locked_until <= $2
+					AND NOT EXISTS (SELECT 1 FROM pgpq_cancellations c WHERE c.task_id = pgpq_tasks.id)
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				attempts,
+				created_at,
+				updated_at
+		)` + shiftBuryExhausted + `, task_plain AS (
+			SELECT id, namespace
+			FROM pgpq_tasks
+			WHERE namespace = ANY($1)` + shiftReady + shiftSlotFree + `
+				AND NOT EXISTS (SELECT 1 FROM pgpq_namespaces n WHERE n.namespace = ANY($1) AND n.aging_interval > 0)
+			ORDER BY
+				priority DESC,
+				updated_at ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		), task_aged AS (
+			SELECT id, namespace
+			FROM pgpq_tasks
+			WHERE namespace = ANY($1)` + shiftReady + shiftSlotFree + `
+				AND array_length($1::TEXT[], 1) = 1
+				AND EXISTS (SELECT 1 FROM pgpq_namespaces n WHERE n.namespace = ANY($1) AND n.aging_interval > 0)
+			ORDER BY
+				aged_at ASC,
+				priority DESC,
+				updated_at ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		), task_mixed AS (
+			SELECT id, namespace
+			FROM pgpq_tasks
+			WHERE namespace = ANY($1)` + shiftReady + shiftSlotFree + `
+				AND array_length($1::TEXT[], 1) > 1
+				AND EXISTS (SELECT 1 FROM pgpq_namespaces n WHERE n.namespace = ANY($1) AND n.aging_interval > 0)
+			ORDER BY` + shiftEffectivePriority + ` DESC,
+				updated_at ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		), task AS (
+			SELECT id, namespace FROM task_plain
+			UNION ALL
+			SELECT id, namespace FROM task_aged
+			UNION ALL
+			SELECT id, namespace FROM task_mixed
+		), slot AS (
+			SELECT s.namespace, s.slot
+			FROM pgpq_concurrency_slots s
+			JOIN task ON task.namespace = s.namespace
+			WHERE s.lease IS NULL OR NOT EXISTS (SELECT 1 FROM pgpq_tasks l WHERE l.locked_by = s.lease AND l.locked_until > $2)
+			FOR UPDATE OF s SKIP LOCKED
+			LIMIT 1
+		), acquired AS (
+			UPDATE pgpq_concurrency_slots
+			SET lease = $3
+			FROM slot
+			WHERE pgpq_concurrency_slots.namespace = slot.namespace
+				AND pgpq_concurrency_slots.slot = slot.slot
+			RETURNING pgpq_concurrency_slots.slot
+		)
+		UPDATE pgpq_tasks
+		SET
+			attempts     = attempts + 1,
+			locked_by    = $3,
+			locked_until = $4
+		FROM task
+		WHERE pgpq_tasks.id = task.id
+			AND (
+				EXISTS (SELECT 1 FROM acquired)
+				OR NOT EXISTS (SELECT 1 FROM pgpq_concurrency_slots s WHERE s.namespace = task.namespace)
+			)
+		RETURNING
+			pgpq_tasks.id,
+			pgpq_tasks.namespace,
+			pgpq_tasks.priority,
+			pgpq_tasks.payload,
+			pgpq_tasks.not_before,
+			pgpq_tasks.max_attempts,
+			pgpq_tasks.unique_key,
+			pgpq_tasks.unique_for,
+			pgpq_tasks.attempts,
+			pgpq_tasks.locked_until,
+			pgpq_tasks.created_at,
+			pgpq_tasks.updated_at
+	`
+
+	stmtShiftN = `
+		WITH RECURSIVE dropped AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT t.id
+				FROM pgpq_cancellations c
+				JOIN pgpq_tasks t ON t.id = c.task_id
+				WHERE t.namespace = $1
+					AND t.locked_until <= $2
+				FOR UPDATE OF t SKIP LOCKED
+			)
+			RETURNING id
+		), uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM dropped)
+		), exhausted AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE namespace = $1
+					AND max_attempts > 0
+					AND attempts >= max_attempts
+					AND locked_until <= $2
+					AND NOT EXISTS (SELECT 1 FROM pgpq_cancellations c WHERE c.task_id = pgpq_tasks.id)
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				attempts,
+				created_at,
+				updated_at
+		)` + shiftBuryExhausted + `, slots AS (
+			SELECT s.slot
+			FROM pgpq_concurrency_slots s
+			WHERE s.namespace = $1
+				AND (s.lease IS NULL OR NOT EXISTS (SELECT 1 FROM pgpq_tasks l WHERE l.locked_by = s.lease AND l.locked_until > $2))
+			FOR UPDATE SKIP LOCKED
+			LIMIT $3
+		), locked_plain AS (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE namespace = $1` + shiftReady + `
+				AND NOT EXISTS (SELECT 1 FROM pgpq_namespaces n WHERE n.namespace = $1 AND n.aging_interval > 0)
+			ORDER BY
+				priority DESC,
+				updated_at ASC
+			FOR UPDATE SKIP LOCKED` + shiftNLimit + `
+		), locked_aged AS (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE namespace = $1` + shiftReady + `
+				AND EXISTS (SELECT 1 FROM pgpq_namespaces n WHERE n.namespace = $1 AND n.aging_interval > 0)
+			ORDER BY
+				aged_at ASC,
+				priority DESC,
+				updated_at ASC
+			FOR UPDATE SKIP LOCKED` + shiftNLimit + `
+		), locked AS (
+			SELECT id FROM locked_plain
+			UNION ALL
+			SELECT id FROM locked_aged
+		), claimed AS (
+			UPDATE pgpq_tasks
+			SET
+				attempts     = attempts + 1,
+				locked_by    = NULL,
+				locked_until = TO_TIMESTAMP(0)
+			FROM locked
+			WHERE pgpq_tasks.id = locked.id
+			RETURNING
+				pgpq_tasks.id,
+				pgpq_tasks.namespace,
+				pgpq_tasks.priority,
+				pgpq_tasks.payload,
+				pgpq_tasks.not_before,
+				pgpq_tasks.max_attempts,
+				pgpq_tasks.unique_key,
+				pgpq_tasks.unique_for,
+				pgpq_tasks.attempts,
+				pgpq_tasks.locked_until,
+				pgpq_tasks.created_at,
+				pgpq_tasks.updated_at
+		)
 		SELECT
 			id,
 			namespace,
 			priority,
 			payload,
 			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			locked_until,
 			created_at,
 			updated_at
-		FROM pgpq_tasks
-		WHERE namespace = $1
-			AND not_before <= $2
+		FROM claimed
 		ORDER BY
 			priority DESC,
 			updated_at ASC
-		FOR UPDATE SKIP LOCKED
-		LIMIT 1
 	`
 
 	stmtClaim = `
-		SELECT
+		UPDATE pgpq_tasks
+		SET
+			attempts     = attempts + 1,
+			locked_by    = $3,
+			locked_until = $4
+		WHERE id = (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND locked_until <= $2
+				AND NOT EXISTS (SELECT 1 FROM pgpq_cancellations c WHERE c.task_id = pgpq_tasks.id)
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING
 			id,
 			namespace,
 			priority,
 			payload,
 			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			locked_until,
 			created_at,
 			updated_at
-		FROM pgpq_tasks
-		WHERE id = $1
-		FOR UPDATE SKIP LOCKED
-		LIMIT 1
 	`
 
 	stmtList = `
@@ -67,30 +491,577 @@ const (
 			priority,
 			payload,
 			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			locked_until,
 			created_at,
 			updated_at
 		FROM pgpq_tasks
-		WHERE namespace = $1
+		WHERE %s
 		ORDER BY
 			priority DESC,
-			updated_at ASC
-		LIMIT $2
-		OFFSET $3
+			updated_at ASC,
+			id ASC
+		LIMIT $1
+		OFFSET $2
 	`
 
 	stmtUpdate = `
 		UPDATE pgpq_tasks
 		SET
-			namespace  = $1,
-			priority   = $2,
-			payload    = $3,
-			not_before = $4,
-			updated_at = $5
-		WHERE id = $6
+			namespace    = $1,
+			priority     = $2,
+			payload      = $3,
+			not_before   = $4,
+			max_attempts = $5,
+			updated_at   = $6,
+			locked_by    = NULL,
+			locked_until = TO_TIMESTAMP(0)
+		WHERE id = $7
+			AND locked_by IS NOT DISTINCT FROM $8
+	`
+
+	stmtRelease = `
+		UPDATE pgpq_tasks
+		SET
+			locked_by    = NULL,
+			locked_until = TO_TIMESTAMP(0)
+		WHERE id = $1
+			AND locked_by IS NOT DISTINCT FROM $2
+	`
+
+	stmtRetry = `
+		UPDATE pgpq_tasks
+		SET
+			not_before   = $3,
+			locked_by    = NULL,
+			locked_until = TO_TIMESTAMP(0)
+		WHERE id = $1
+			AND locked_by IS NOT DISTINCT FROM $2
+	`
+
+	stmtDropCancelled = `
+		WITH uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id = $1
+				AND EXISTS (
+					SELECT 1
+					FROM pgpq_tasks
+					WHERE id = $1
+						AND locked_by IS NOT DISTINCT FROM $2
+				)
+		)
+		DELETE FROM pgpq_tasks
+		WHERE id = $1
+			AND locked_by IS NOT DISTINCT FROM $2
+	`
+
+	stmtDelete = `
+		WITH deleted AS (
+			DELETE FROM pgpq_tasks
+			WHERE id = (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE id = $1
+					AND locked_until <= $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id
+		), uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM deleted)
+		)
+		SELECT
+			(SELECT COUNT(*) FROM deleted),
+			(SELECT COUNT(*) FROM pgpq_tasks WHERE id = $1)
+	`
+
+	stmtCancel = `
+		WITH deleted AS (
+			DELETE FROM pgpq_tasks
+			WHERE id = (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE id = $1
+					AND locked_until <= $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id
+		), uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM deleted)
+		), cancelled AS (
+			INSERT INTO pgpq_cancellations (task_id, cancelled_at)
+			SELECT id, $2
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND NOT EXISTS (SELECT 1 FROM deleted)
+			ON CONFLICT (task_id) DO UPDATE
+			SET cancelled_at = EXCLUDED.cancelled_at
+			RETURNING task_id
+		)
+		SELECT (SELECT COUNT(*) FROM deleted) + (SELECT COUNT(*) FROM cancelled)
+	`
+
+	stmtUpdateWhere = `
+		UPDATE pgpq_tasks
+		SET
+			namespace  = COALESCE($3, namespace),
+			priority   = COALESCE($4, priority),
+			not_before = COALESCE($5, not_before),
+			updated_at = CASE WHEN $7::BOOLEAN THEN $6 ELSE updated_at END
+		WHERE id IN (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE %s
+				AND locked_until <= $6
+			ORDER BY
+				priority DESC,
+				updated_at ASC,
+				id ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT $1
+			OFFSET $2
+		)
+	`
+
+	stmtSetAging = `
+		INSERT INTO pgpq_namespaces (namespace, aging_interval, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (namespace) DO UPDATE
+		SET
+			aging_interval = EXCLUDED.aging_interval,
+			updated_at     = EXCLUDED.updated_at
+	`
+
+	// stmtAgeTasks recomputes aged_at of a batch of tasks, skipping tasks
+	// which are locked by transaction claims.
+	stmtAgeTasks = `
+		UPDATE pgpq_tasks
+		SET aged_at = CASE WHEN $2::BIGINT > 0 THEN updated_at - priority * $2::BIGINT * INTERVAL '1 microsecond' END
+		WHERE id IN (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE namespace = $1
+				AND aged_at IS DISTINCT FROM CASE WHEN $2::BIGINT > 0 THEN updated_at - priority * $2::BIGINT * INTERVAL '1 microsecond' END
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	stmtSetPaused = `
+		INSERT INTO pgpq_namespaces (namespace, paused, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (namespace) DO UPDATE
+		SET
+			paused     = EXCLUDED.paused,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	stmtPaused = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM pgpq_namespaces
+			WHERE namespace = $1
+				AND paused
+		)
+	`
+
+	stmtBlockedNamespaces = `
+		WITH available AS (
+			SELECT s.namespace
+			FROM pgpq_concurrency_slots s
+			WHERE s.namespace = ANY($1)
+				AND (s.lease IS NULL OR NOT EXISTS (SELECT 1 FROM pgpq_tasks l WHERE l.locked_by = s.lease AND l.locked_until > $2))
+			FOR KEY SHARE SKIP LOCKED
+		)
+		SELECT namespace, TRUE
+		FROM pgpq_namespaces
+		WHERE namespace = ANY($1)
+			AND paused
+		UNION
+		SELECT DISTINCT namespace, FALSE
+		FROM pgpq_concurrency_slots
+		WHERE namespace = ANY($1)
+			AND namespace NOT IN (SELECT namespace FROM available)
+	`
+
+	stmtSetConcurrencyLimit = `
+		WITH removed AS (
+			DELETE FROM pgpq_concurrency_slots
+			WHERE namespace = $1
+				AND slot >= $2
+		)
+		INSERT INTO pgpq_concurrency_slots (namespace, slot)
+		SELECT $1, generate_series(0, $2 - 1)
+		ON CONFLICT (namespace, slot) DO NOTHING
+	`
+
+	stmtExtend = `
+		UPDATE pgpq_tasks
+		SET locked_until = $1
+		WHERE id = $2
+			AND locked_by = $3
 	`
 
 	stmtDone = `
+		WITH uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id = $1
+				AND EXISTS (
+					SELECT 1
+					FROM pgpq_tasks
+					WHERE id = $1
+						AND locked_by IS NOT DISTINCT FROM $2
+				)
+		), unblocked AS (
+			DELETE FROM pgpq_task_deps
+			WHERE parent_id = $1
+				AND EXISTS (
+					SELECT 1
+					FROM pgpq_tasks
+					WHERE id = $1
+						AND locked_by IS NOT DISTINCT FROM $2
+				)
+		), stored AS (
+			INSERT INTO pgpq_task_results (id, namespace, priority, payload, attempts, result, created_at, finished_at)
+			SELECT id, namespace, priority, payload, attempts, $4::JSONB, created_at, $3::TIMESTAMPTZ
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND locked_by IS NOT DISTINCT FROM $2
+				AND $4::JSONB IS NOT NULL
+			ON CONFLICT (id) DO UPDATE
+			SET
+				namespace   = EXCLUDED.namespace,
+				priority    = EXCLUDED.priority,
+				payload     = EXCLUDED.payload,
+				attempts    = EXCLUDED.attempts,
+				result      = EXCLUDED.result,
+				created_at  = EXCLUDED.created_at,
+				finished_at = EXCLUDED.finished_at
+		), archived AS (
+			INSERT INTO pgpq_tasks_archive (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, result, worker_id, created_at, updated_at, completed_at)
+			SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, $4::JSONB, $6::TEXT, created_at, updated_at, $3::TIMESTAMPTZ
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND locked_by IS NOT DISTINCT FROM $2
+				AND $5::BOOLEAN
+			ON CONFLICT (id) DO UPDATE
+			SET
+				namespace    = EXCLUDED.namespace,
+				priority     = EXCLUDED.priority,
+				payload      = EXCLUDED.payload,
+				not_before   = EXCLUDED.not_before,
+				max_attempts = EXCLUDED.max_attempts,
+				unique_key   = EXCLUDED.unique_key,
+				unique_for   = EXCLUDED.unique_for,
+				attempts     = EXCLUDED.attempts,
+				result       = EXCLUDED.result,
+				worker_id    = EXCLUDED.worker_id,
+				created_at   = EXCLUDED.created_at,
+				updated_at   = EXCLUDED.updated_at,
+				completed_at = EXCLUDED.completed_at
+		), reserved AS (
+			INSERT INTO pgpq_unique_keys (namespace, unique_key, task_id, reserved_until)
+			SELECT namespace, unique_key, id, $3::TIMESTAMPTZ + unique_for * INTERVAL '1 microsecond'
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND locked_by IS NOT DISTINCT FROM $2
+				AND unique_key IS NOT NULL
+				AND unique_for > 0
+			ON CONFLICT (namespace, unique_key) DO UPDATE
+			SET
+				task_id        = EXCLUDED.task_id,
+				reserved_until = EXCLUDED.reserved_until
+		)
 		DELETE FROM pgpq_tasks
 		WHERE id = $1
+			AND locked_by IS NOT DISTINCT FROM $2
+	`
+
+	stmtBury = `
+		WITH RECURSIVE uncancelled AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id = $1
+				AND EXISTS (
+					SELECT 1
+					FROM pgpq_tasks
+					WHERE id = $1
+						AND locked_by IS NOT DISTINCT FROM $4
+				)
+		), buried AS (
+			DELETE FROM pgpq_tasks
+			WHERE id = $1
+				AND locked_by IS NOT DISTINCT FROM $4
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				attempts,
+				created_at,
+				updated_at
+		), descendants AS (
+			SELECT task_id
+			FROM pgpq_task_deps
+			WHERE parent_id = $1
+				AND cancel_on_failure
+			UNION
+			SELECT d.task_id
+			FROM pgpq_task_deps d
+			JOIN descendants ON descendants.task_id = d.parent_id
+			WHERE d.cancel_on_failure
+		), cancelled AS (
+			DELETE FROM pgpq_tasks
+			WHERE id IN (
+				SELECT id
+				FROM pgpq_tasks
+				WHERE id IN (SELECT task_id FROM descendants)
+					AND EXISTS (SELECT 1 FROM buried)
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				attempts,
+				created_at,
+				updated_at
+		), uncancelled_descendants AS (
+			DELETE FROM pgpq_cancellations
+			WHERE task_id IN (SELECT id FROM cancelled)
+		)
+		INSERT INTO pgpq_dead_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at, reason, failed_at)
+		SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at, $2::TEXT, $3::TIMESTAMPTZ
+		FROM buried
+		UNION ALL
+		SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, attempts, created_at, updated_at, 'parent ' || $1::TEXT || ' failed', $3::TIMESTAMPTZ
+		FROM cancelled
+		ON CONFLICT (id) DO UPDATE
+		SET
+			namespace    = EXCLUDED.namespace,
+			priority     = EXCLUDED.priority,
+			payload      = EXCLUDED.payload,
+			not_before   = EXCLUDED.not_before,
+			max_attempts = EXCLUDED.max_attempts,
+			unique_key   = EXCLUDED.unique_key,
+			unique_for   = EXCLUDED.unique_for,
+			attempts     = EXCLUDED.attempts,
+			created_at   = EXCLUDED.created_at,
+			updated_at   = EXCLUDED.updated_at,
+			reason       = EXCLUDED.reason,
+			failed_at    = EXCLUDED.failed_at
+	`
+
+	stmtGetDead = `
+		SELECT
+			id,
+			namespace,
+			priority,
+			payload,
+			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			created_at,
+			updated_at,
+			reason,
+			failed_at
+		FROM pgpq_dead_tasks
+		WHERE id = $1
+	`
+
+	stmtListDead = `
+		SELECT
+			id,
+			namespace,
+			priority,
+			payload,
+			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			created_at,
+			updated_at,
+			reason,
+			failed_at
+		FROM pgpq_dead_tasks
+		WHERE %s
+		ORDER BY
+			priority DESC,
+			updated_at ASC,
+			id ASC
+		LIMIT $1
+		OFFSET $2
+	`
+
+	stmtGetArchived = `
+		SELECT
+			id,
+			namespace,
+			priority,
+			payload,
+			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			result,
+			worker_id,
+			created_at,
+			updated_at,
+			completed_at
+		FROM pgpq_tasks_archive
+		WHERE id = $1
+	`
+
+	stmtListArchive = `
+		SELECT
+			id,
+			namespace,
+			priority,
+			payload,
+			not_before,
+			max_attempts,
+			unique_key,
+			unique_for,
+			attempts,
+			result,
+			worker_id,
+			created_at,
+			updated_at,
+			completed_at
+		FROM pgpq_tasks_archive
+		WHERE %s
+		ORDER BY
+			completed_at DESC,
+			id ASC
+		LIMIT $1
+		OFFSET $2
+	`
+
+	stmtRequeueDead = `
+		WITH requeued AS (
+			DELETE FROM pgpq_dead_tasks
+			WHERE id = $1
+			RETURNING
+				id,
+				namespace,
+				priority,
+				payload,
+				not_before,
+				max_attempts,
+				unique_key,
+				unique_for,
+				created_at
+		)
+		INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, updated_at)
+		SELECT id, namespace, priority, payload, not_before, max_attempts, unique_key, unique_for, created_at, $2
+		FROM requeued
+		RETURNING id
+	`
+
+	stmtPurgeDead = `
+		DELETE FROM pgpq_dead_tasks
+		WHERE namespace = $1
+			AND failed_at < $2
+	`
+
+	stmtUpsertSchedule = `
+		INSERT INTO pgpq_schedules (name, spec, namespace, priority, payload, max_attempts, next_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (name) DO UPDATE
+		SET
+			spec         = EXCLUDED.spec,
+			namespace    = EXCLUDED.namespace,
+			priority     = EXCLUDED.priority,
+			payload      = EXCLUDED.payload,
+			max_attempts = EXCLUDED.max_attempts,
+			next_at      = EXCLUDED.next_at,
+			updated_at   = EXCLUDED.updated_at
+	`
+
+	stmtGetSchedule = `
+		SELECT
+			name,
+			spec,
+			namespace,
+			priority,
+			payload,
+			max_attempts,
+			paused,
+			next_at,
+			created_at,
+			updated_at
+		FROM pgpq_schedules
+		WHERE name = $1
+	`
+
+	stmtListSchedules = `
+		SELECT
+			name,
+			spec,
+			namespace,
+			priority,
+			payload,
+			max_attempts,
+			paused,
+			next_at,
+			created_at,
+			updated_at
+		FROM pgpq_schedules
+		WHERE namespace = $1
+		ORDER BY name ASC
+		LIMIT $2
+		OFFSET $3
+	`
+
+	stmtDueSchedules = `
+		SELECT
+			name,
+			spec,
+			namespace,
+			priority,
+			payload,
+			max_attempts,
+			paused,
+			next_at,
+			created_at,
+			updated_at
+		FROM pgpq_schedules
+		WHERE NOT paused
+			AND next_at <= $1
+		ORDER BY next_at ASC
+		FOR UPDATE SKIP LOCKED
+	`
+
+	stmtPushOccurrence = `
+		INSERT INTO pgpq_tasks (id, namespace, priority, payload, not_before, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	stmtDeleteOccurrence = `
+		DELETE FROM pgpq_tasks
+		WHERE id = (
+			SELECT id
+			FROM pgpq_tasks
+			WHERE id = $1
+				AND not_before > $2
+			FOR UPDATE SKIP LOCKED
+		)
 	`
 )
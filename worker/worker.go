@@ -0,0 +1,208 @@
+// Package worker implements a consumer runtime for pgpq queues.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bsm/pgpq"
+)
+
+// Client defines pgpq client (only needed methods).
+type Client interface {
+	WaitShift(context.Context, ...pgpq.ScopeOption) (*pgpq.Claim, error)
+}
+
+// Handler processes claimed tasks. If the handler returns nil, the task is
+// marked as done, otherwise the failure is recorded via Claim.Retry. Handlers
+// must not release the claim themselves.
+type Handler interface {
+	Handle(context.Context, *pgpq.Claim) error
+}
+
+// HandlerFunc is a func adapter for Handler.
+type HandlerFunc func(context.Context, *pgpq.Claim) error
+
+// Handle implements Handler.
+func (f HandlerFunc) Handle(ctx context.Context, claim *pgpq.Claim) error { return f(ctx, claim) }
+
+// Options contain worker options.
+type Options struct {
+	// Namespaces to consume from. Default: the client's namespace.
+	Namespaces []string
+
+	// Concurrency is the number of tasks processed in parallel per namespace.
+	// Default: 1
+	Concurrency int
+
+	// PollInterval is the interval at which idle workers poll for tasks in
+	// absence of notifications. Default: 1s
+	PollInterval time.Duration
+
+	// Backoff is the delay before a retry when tasks cannot be shifted due
+	// to an error. Default: 1s
+	Backoff time.Duration
+
+	// RetryDelay is the delay before a task is retried after the handler
+	// returned an error. Default: 1s
+	RetryDelay time.Duration
+
+	// Timeout limits the time a handler may take to process a single task.
+	// Default: 0 (no timeout)
+	Timeout time.Duration
+
+	// Lease enables lease-based claims with the given duration. Leases are
+	// extended in the background while tasks are being processed.
+	// Default: 0 (transaction-based claims)
+	Lease time.Duration
+
+	// Archive moves completed tasks into the archive instead of deleting
+	// them. Default: false
+	Archive bool
+
+	// WorkerID is recorded with archived tasks. Default: "" (none)
+	WorkerID string
+
+	// ErrorHandler is called with errors that occur while shifting or
+	// releasing tasks as well as with errors returned by the handler.
+	// Default: nil (ignore errors)
+	ErrorHandler func(error)
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+
+	if len(oo.Namespaces) == 0 {
+		oo.Namespaces = []string{""}
+	}
+	if oo.Concurrency < 1 {
+		oo.Concurrency = 1
+	}
+	if oo.PollInterval <= 0 {
+		oo.PollInterval = time.Second
+	}
+	if oo.Backoff <= 0 {
+		oo.Backoff = time.Second
+	}
+	if oo.RetryDelay <= 0 {
+		oo.RetryDelay = time.Second
+	}
+	return &oo
+}
+
+// Worker shifts tasks from the queue and processes them using a handler.
+type Worker struct {
+	client  Client
+	handler Handler
+	opt     *Options
+}
+
+// New inits a new worker.
+func New(client Client, handler Handler, opt *Options) *Worker {
+	return &Worker{
+		client:  client,
+		handler: handler,
+		opt:     opt.norm(),
+	}
+}
+
+// Run starts processing tasks and blocks until ctx is cancelled. It then
+// waits for all in-flight tasks to be processed before it returns.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ns := range w.opt.Namespaces {
+		scope := w.scope(ns)
+		for i := 0; i < w.opt.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.loop(ctx, scope)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func (w *Worker) scope(ns string) []pgpq.ScopeOption {
+	scope := []pgpq.ScopeOption{pgpq.WithPollInterval(w.opt.PollInterval)}
+	if ns != "" {
+		scope = append(scope, pgpq.WithNamespace(ns))
+	}
+	if w.opt.Lease > 0 {
+		scope = append(scope, pgpq.WithLease(w.opt.Lease))
+	}
+	if w.opt.Archive {
+		scope = append(scope, pgpq.WithArchive())
+	}
+	if w.opt.WorkerID != "" {
+		scope = append(scope, pgpq.WithWorkerID(w.opt.WorkerID))
+	}
+	return scope
+}
+
+func (w *Worker) loop(ctx context.Context, scope []pgpq.ScopeOption) {
+	for {
+		claim, err := w.client.WaitShift(ctx, scope...)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			w.handleError(err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.opt.Backoff):
+			}
+			continue
+		}
+
+		w.process(claim)
+	}
+}
+
+func (w *Worker) process(claim *pgpq.Claim) {
+	// in-flight tasks are not aborted on shutdown
+	ctx := context.Background()
+	if w.opt.Lease > 0 {
+		ctx = claim.KeepAlive(ctx, w.opt.Lease/3)
+	}
+	if w.opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opt.Timeout)
+		defer cancel()
+	}
+
+	if err := w.handle(ctx, claim); err != nil {
+		w.handleError(err)
+
+		if err := claim.Retry(context.Background(), err.Error(), w.opt.RetryDelay); err != nil {
+			w.handleError(err)
+		}
+		return
+	}
+
+	if err := claim.Done(context.Background()); err != nil {
+		w.handleError(err)
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, claim *pgpq.Claim) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return w.handler.Handle(ctx, claim)
+}
+
+func (w *Worker) handleError(err error) {
+	if w.opt.ErrorHandler != nil {
+		w.opt.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,272 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/pgpq"
+	"github.com/bsm/pgpq/worker"
+)
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+
+	for _, payload := range []string{`{"ok":1}`, `{"ok":2}`, `{"fail":3}`, `{"panic":4}`} {
+		if err := client.Push(ctx, &pgpq.Task{Payload: []byte(payload), MaxAttempts: 1}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var seen []string
+	w := worker.New(client, worker.HandlerFunc(func(_ context.Context, claim *pgpq.Claim) error {
+		mu.Lock()
+		seen = append(seen, string(claim.Payload))
+		mu.Unlock()
+
+		switch string(claim.Payload) {
+		case `{"fail": 3}`:
+			return errors.New("failed")
+		case `{"panic": 4}`:
+			panic("boom")
+		}
+		return nil
+	}), &worker.Options{
+		Concurrency:  2,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	stop := run(w)
+	waitEmpty(t, client)
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp, got := 4, len(seen); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	dead, err := client.ListDead(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 2, len(dead); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	reasons := map[string]bool{dead[0].Reason: true, dead[1].Reason: true}
+	if !reasons["failed"] || !reasons["panic: boom"] {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+}
+
+func TestWorker_retryDelay(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+
+	if err := client.Push(ctx, &pgpq.Task{Payload: []byte(`{"fail":1}`)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	w := worker.New(client, worker.HandlerFunc(func(_ context.Context, _ *pgpq.Claim) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}), &worker.Options{
+		PollInterval: 10 * time.Millisecond,
+		RetryDelay:   300 * time.Millisecond,
+	})
+
+	stop := run(w)
+	waitEmpty(t, client)
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp, got := 2, len(attempts); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if delay := attempts[1].Sub(attempts[0]); delay < 300*time.Millisecond {
+		t.Errorf("expected retry to be delayed, got %v", delay)
+	}
+}
+
+func TestWorker_timeout(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+
+	if err := client.Push(ctx, &pgpq.Task{Payload: []byte(`{"slow":1}`), MaxAttempts: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	w := worker.New(client, worker.HandlerFunc(func(ctx context.Context, _ *pgpq.Claim) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}), &worker.Options{
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      100 * time.Millisecond,
+	})
+
+	stop := run(w)
+	waitEmpty(t, client)
+	stop()
+
+	dead, err := client.ListDead(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, len(dead); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	} else if exp, got := context.DeadlineExceeded.Error(), dead[0].Reason; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestWorker_lease(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+
+	if err := client.Push(ctx, &pgpq.Task{Payload: []byte(`{"slow":1}`)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	w := worker.New(client, worker.HandlerFunc(func(ctx context.Context, _ *pgpq.Claim) error {
+		// outlive the lease several times over
+		time.Sleep(time.Second)
+
+		if err := context.Cause(ctx); err != nil {
+			return err
+		}
+		if _, err := client.Shift(ctx, pgpq.WithLease(time.Minute)); !errors.Is(err, pgpq.ErrNoTask) {
+			t.Errorf("expected %v, got %v", pgpq.ErrNoTask, err)
+		}
+		return nil
+	}), &worker.Options{
+		PollInterval: 10 * time.Millisecond,
+		Lease:        300 * time.Millisecond,
+		ErrorHandler: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+
+	stop := run(w)
+	waitEmpty(t, client)
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestWorker_drain(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+
+	if err := client.Push(ctx, &pgpq.Task{Payload: []byte(`{"slow":1}`)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	w := worker.New(client, worker.HandlerFunc(func(ctx context.Context, _ *pgpq.Claim) error {
+		close(started)
+		<-unblock
+		return ctx.Err()
+	}), &worker.Options{
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	wctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		w.Run(wctx)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("expected Run to wait for in-flight tasks")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(unblock)
+	<-done
+
+	if n, err := client.Len(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(0), n; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func connect(t *testing.T) *pgpq.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	url := "postgres://localhost/pgpq_test?sslmode=disable"
+	if v := os.Getenv("DATABASE_URL"); v != "" {
+		url = v
+	}
+
+	client, err := pgpq.Connect(ctx, url, pgpq.WithNamespace("worker"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if err := client.Truncate(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return client
+}
+
+func run(w *worker.Worker) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitEmpty(t *testing.T, client *pgpq.Client) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if n, err := client.Len(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for tasks to be processed")
+}